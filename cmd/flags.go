@@ -4,7 +4,15 @@ import "flag"
 
 var IsStrictMode bool
 
+var ClassPathTemplate string
+
 func ParseFlags() {
 	flag.BoolVar(&IsStrictMode, "strict", false, "Enable strict mode for ti diagnostics")
+	flag.StringVar(
+		&ClassPathTemplate,
+		"class-path",
+		"lib/{path}.rb",
+		"Where new ruby classes are created, {path} is the snake_cased namespace",
+	)
 	flag.Parse()
 }
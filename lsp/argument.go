@@ -0,0 +1,311 @@
+package lsp
+
+import (
+	"hash/fnv"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const callSearchLines = 20
+
+var suppliedKeywordPattern = regexp.MustCompile(`(?:^|[(,\s])([a-z_]\w*):(?:[^:]|$)`)
+
+const receiverCacheSize = 256
+
+// receiverCache keeps the receiver class of a call site while its arguments
+// are typed, keyed by the code before the call and the call target
+var (
+	receiverCache      = make(map[uint64]string)
+	receiverCacheMutex sync.Mutex
+)
+
+// CallInfo is the method call whose parentheses enclose the cursor
+type CallInfo struct {
+	Line     uint32
+	Target   string
+	Supplied []string
+}
+
+// findCallAtCursor scans backwards for the unmatched ( before the cursor
+// foo.bar(1, key: 2, | -> Target: foo.bar, Supplied: [key]
+func findCallAtCursor(content string, line uint32, character uint32) *CallInfo {
+	lines := strings.Split(content, "\n")
+	if int(line) >= len(lines) {
+		return nil
+	}
+
+	depth := 0
+	var argParts []string
+
+	for row := int(line); row >= 0 && row > int(line)-callSearchLines; row-- {
+		text := lines[row]
+		if row == int(line) && int(character) < len(text) {
+			text = text[:character]
+		}
+
+		text = stripRubyLine(text)
+
+		for i := len(text) - 1; i >= 0; i-- {
+			switch text[i] {
+			case ')', ']', '}':
+				depth++
+			case '[', '{':
+				depth--
+			case '(':
+				if depth > 0 {
+					depth--
+					continue
+				}
+
+				argParts = append([]string{text[i+1:]}, argParts...)
+
+				target := extractTargetCode(text[:i], i)
+				if target == "" {
+					return nil
+				}
+
+				var supplied []string
+				args := strings.Join(argParts, "\n")
+
+				for _, matches := range suppliedKeywordPattern.FindAllStringSubmatch(args, -1) {
+					supplied = appendUnique(supplied, matches[1])
+				}
+
+				return &CallInfo{
+					Line:     uint32(row),
+					Target:   target,
+					Supplied: supplied,
+				}
+			}
+
+			if depth < 0 {
+				return nil
+			}
+		}
+
+		argParts = append([]string{text}, argParts...)
+	}
+
+	return nil
+}
+
+// getReceiverClass asks ti --define for the class the target is called on
+func getReceiverClass(scope *workspaceScope, content string, line uint32, targetCode string) (string, string) {
+	codeLines := strings.Split(content, "\n")
+	if int(line) >= len(codeLines) {
+		return "", ""
+	}
+
+	codeLines[line] = targetCode
+	modifiedContent := strings.Join(codeLines, "\n")
+
+	tmpFile, err := os.CreateTemp("", "ruby-ti-lsp-*.rb")
+	if err != nil {
+		return "", ""
+	}
+
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	if _, err := tmpFile.WriteString(modifiedContent); err != nil {
+		return "", ""
+	}
+	tmpFile.Close()
+
+	prefixInfo, _, _ := getTiOutForDefinition(scope, tmpFile.Name(), int(line)+1)
+
+	parts := strings.SplitN(strings.TrimPrefix(prefixInfo, "@"), ":::", 2)
+	if len(parts) < 2 {
+		return "", ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// findConfigMethod looks a method up in .ti-config, following extends
+func findConfigMethod(
+	classConfigs []TiClassConfig,
+	className string,
+	methodName string,
+	isClassMethod bool,
+	visited map[string]bool,
+) *TiMethod {
+
+	if visited[className] {
+		return nil
+	}
+
+	visited[className] = true
+
+	for _, classConfig := range classConfigs {
+		if classConfig.Class != className {
+			continue
+		}
+
+		methods := classConfig.InstanceMethods
+		if isClassMethod {
+			methods = classConfig.ClassMethods
+		}
+
+		for i := range methods {
+			if methods[i].Name == methodName {
+				return &methods[i]
+			}
+		}
+
+		for _, parentClass := range classConfig.Extends {
+			method := findConfigMethod(
+				classConfigs,
+				parentClass,
+				methodName,
+				isClassMethod,
+				visited,
+			)
+
+			if method != nil {
+				return method
+			}
+		}
+	}
+
+	return nil
+}
+
+// getCachedReceiverClass runs ti --define once per call site, typing the
+// arguments does not change the code before the call
+func getCachedReceiverClass(
+	scope *workspaceScope,
+	uri protocol.DocumentUri,
+	content string,
+	call *CallInfo,
+) string {
+
+	lines := strings.Split(content, "\n")
+
+	hash := fnv.New64a()
+	hash.Write([]byte(scope.Root))
+	hash.Write([]byte{0})
+	hash.Write([]byte(uri))
+	hash.Write([]byte{0})
+	hash.Write([]byte(strings.Join(lines[:call.Line], "\n")))
+	hash.Write([]byte{0})
+	hash.Write([]byte(call.Target))
+	key := hash.Sum64()
+
+	receiverCacheMutex.Lock()
+	className, ok := receiverCache[key]
+	receiverCacheMutex.Unlock()
+
+	if ok {
+		return className
+	}
+
+	_, className = getReceiverClass(scope, content, call.Line, call.Target)
+
+	// a failed or timed out run is asked again next time
+	if className == "" {
+		return className
+	}
+
+	receiverCacheMutex.Lock()
+	if len(receiverCache) >= receiverCacheSize {
+		clear(receiverCache)
+	}
+	receiverCache[key] = className
+	receiverCacheMutex.Unlock()
+
+	return className
+}
+
+// invalidateReceiverCache forgets every receiver when a .ti-config file of the
+// project changes, ti types the receivers from it
+func invalidateReceiverCache(uri protocol.DocumentUri) {
+	if !isConfigJsonFile(findDocumentScope(uri), uri) {
+		return
+	}
+
+	receiverCacheMutex.Lock()
+	clear(receiverCache)
+	receiverCacheMutex.Unlock()
+}
+
+func findKeywordArgumentCompletion(
+	scope *workspaceScope,
+	uri protocol.DocumentUri,
+	content string,
+	line uint32,
+	character uint32,
+) []Sig {
+
+	call := findCallAtCursor(content, line, character)
+	if call == nil {
+		return []Sig{}
+	}
+
+	methodName := extractMethodName(call.Target, len(call.Target))
+
+	receiver := ""
+	if idx := strings.LastIndex(call.Target, "."); idx != -1 {
+		receiver = call.Target[:idx]
+	}
+
+	isClassMethod := receiver != "" && receiver[0] >= 'A' && receiver[0] <= 'Z'
+
+	className := getCachedReceiverClass(scope, uri, content, call)
+	if className == "" && isClassMethod {
+		className = receiver
+	}
+
+	if className == "" {
+		return []Sig{}
+	}
+
+	classConfigs := loadClassConfigs(scope)
+
+	method := findConfigMethod(
+		classConfigs,
+		className,
+		methodName,
+		isClassMethod,
+		make(map[string]bool),
+	)
+
+	if method == nil {
+		method = findConfigMethod(
+			classConfigs,
+			className,
+			methodName,
+			!isClassMethod,
+			make(map[string]bool),
+		)
+	}
+
+	if method == nil {
+		return []Sig{}
+	}
+
+	var signatures []Sig
+
+	for _, argument := range method.Arguments {
+		if argument.Key == "" {
+			continue
+		}
+
+		if slices.Contains(call.Supplied, argument.Key) {
+			continue
+		}
+
+		signatures = append(signatures, Sig{
+			Method: argument.Key + ":",
+			Detail: strings.Join(argument.Type, " | "),
+			Kind:   protocol.CompletionItemKindProperty,
+		})
+	}
+
+	return signatures
+}
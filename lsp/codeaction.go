@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -25,7 +24,7 @@ type TiClassConfig struct {
 type TiMethod struct {
 	Name            string       `json:"name"`
 	Arguments       []TiArgument `json:"arguments"`
-	BlockParameters []string     `json:"block_parameters,omitempty"`
+	BlockParameters []string     `json:"block_parameters,omitzero"` // empty for a block without parameters
 	ReturnType      TiReturnType `json:"return_type"`
 	Document        string       `json:"document"`
 }
@@ -61,6 +60,12 @@ func textDocumentCodeAction(
 	params *protocol.CodeActionParams,
 ) (any, error) {
 
+	scope := findDocumentScope(params.TextDocument.URI)
+
+	if !getSettings(scope).Features.CodeActions {
+		return nil, nil
+	}
+
 	var codeActions []protocol.CodeAction
 
 	for _, diagnostic := range params.Context.Diagnostics {
@@ -71,31 +76,63 @@ func textDocumentCodeAction(
 			continue
 		}
 
+		codeActions = append(
+			codeActions,
+			createDidYouMeanCodeActions(params.TextDocument.URI, diagnostic)...,
+		)
+
 		switch errorInfo.ErrorType {
 		case "class":
 			action :=
-				createClassCodeAction(errorInfo, diagnostic)
+				createClassCodeAction(scope, errorInfo, diagnostic)
 
 			if action != nil {
 				codeActions = append(codeActions, *action)
 			}
 
+			rubyAction :=
+				createRubyClassCodeAction(scope, params.TextDocument.URI, errorInfo, diagnostic)
+
+			if rubyAction != nil {
+				codeActions = append(codeActions, *rubyAction)
+			}
+
 		case "method":
-			action := createMethodCodeAction(errorInfo, diagnostic)
-			if action != nil {
-				codeActions = append(codeActions, *action)
+			rubyAction :=
+				createRubyMethodCodeAction(scope, params.TextDocument.URI, errorInfo, diagnostic)
+
+			if rubyAction != nil {
+				codeActions = append(codeActions, *rubyAction)
 			}
 
-			extendsClasses := getExtendsClasses(params.TextDocument.URI, errorInfo.ClassName)
-			for _, parentClass := range extendsClasses {
-				action := createMethodCodeActionForClass(errorInfo, diagnostic, parentClass)
+			// the typed stub is inferred once the fix is picked
+			newMethod := makeUntypedMethod(errorInfo.MethodName, "")
+
+			targetClasses := append(
+				[]string{errorInfo.ClassName},
+				getExtendsClasses(scope, params.TextDocument.URI, errorInfo.ClassName)...,
+			)
+
+			for _, targetClass := range targetClasses {
+				action := createMethodCodeActionForClass(scope, errorInfo, diagnostic, targetClass, newMethod)
 				if action != nil {
+					deferMethodStub(action, params.TextDocument.URI, errorInfo, targetClass)
 					codeActions = append(codeActions, *action)
 				}
 			}
 		}
 	}
 
+	codeActions = append(
+		codeActions,
+		createExtractCodeActions(scope, params.TextDocument.URI, params.Range)...,
+	)
+
+	codeActions = append(
+		codeActions,
+		createGenerateConfigCodeActions(params.TextDocument.URI, params.Range)...,
+	)
+
 	return codeActions, nil
 }
 
@@ -150,13 +187,14 @@ func parseErrorMessage(message string, line uint32) *ErrorInfo {
 }
 
 func createClassCodeAction(
+	scope *workspaceScope,
 	errorInfo *ErrorInfo,
 	diagnostic protocol.Diagnostic,
 ) *protocol.CodeAction {
 
 	title := fmt.Sprintf("Create class definition for '%s'", errorInfo.ClassName)
 
-	configDir := findBuiltinConfigDir()
+	configDir := findBuiltinConfigDir(scope)
 	if configDir == "" {
 		return nil
 	}
@@ -213,14 +251,14 @@ func createClassCodeAction(
 }
 
 func getDocumentContent(uri protocol.DocumentUri) string {
-	content, ok := documentContents[string(uri)]
+	content, ok := getOpenDocument(string(uri))
 	if !ok {
 		return ""
 	}
 	return content
 }
 
-func getExtendsClasses(uri protocol.DocumentUri, className string) []string {
+func getExtendsClasses(scope *workspaceScope, uri protocol.DocumentUri, className string) []string {
 	documentContent := getDocumentContent(uri)
 	if documentContent == "" {
 		return []string{}
@@ -237,8 +275,11 @@ func getExtendsClasses(uri protocol.DocumentUri, className string) []string {
 	}
 	tmpFile.Close()
 
-	cmd := exec.Command("ti", tmpFile.Name(), "--extends", "--class="+className)
-	output, err := cmd.Output()
+	ctx, cancel := tiTimeoutContext(scope)
+	defer cancel()
+
+	cmd := tiCommand(scope, ctx, tmpFile.Name(), "--extends", "--class="+className)
+	output, err := runTi(ctx, cmd)
 	if err != nil {
 		return []string{}
 	}
@@ -256,9 +297,11 @@ func getExtendsClasses(uri protocol.DocumentUri, className string) []string {
 }
 
 func createMethodCodeActionForClass(
+	scope *workspaceScope,
 	errorInfo *ErrorInfo,
 	diagnostic protocol.Diagnostic,
 	targetClass string,
+	newMethod TiMethod,
 ) *protocol.CodeAction {
 
 	var title string
@@ -279,7 +322,7 @@ func createMethodCodeActionForClass(
 		)
 	}
 
-	configDir := findBuiltinConfigDir()
+	configDir := findBuiltinConfigDir(scope)
 	if configDir == "" {
 		return nil
 	}
@@ -291,56 +334,22 @@ func createMethodCodeActionForClass(
 		return nil
 	}
 
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil
-	}
-
-	var classConfig TiClassConfig
-	if err := json.Unmarshal(data, &classConfig); err != nil {
-		return nil
-	}
-
-	if classConfig.Extends == nil {
-		classConfig.Extends = []string{}
-	}
-
-	newMethod := TiMethod{
-		Name: errorInfo.MethodName,
-		Arguments: []TiArgument{
-			{Type: []string{"Untyped"}},
-		},
-		ReturnType: TiReturnType{
-			Type: []string{"Untyped"},
-		},
-	}
+	content := readWorkspaceFile(filePath)
 
+	section := "instance_methods"
 	if errorInfo.MethodType == "class" {
-		classConfig.ClassMethods = append(classConfig.ClassMethods, newMethod)
-	} else {
-		classConfig.InstanceMethods = append(classConfig.InstanceMethods, newMethod)
+		section = "class_methods"
 	}
 
-	jsonData, err := json.MarshalIndent(classConfig, "", "  ")
-	if err != nil {
+	textEdit := makeAppendToArrayEdit(content, section, newMethod)
+	if textEdit == nil {
 		return nil
 	}
 
 	changes := make(map[protocol.DocumentUri][]protocol.TextEdit)
 	fileUri := protocol.DocumentUri("file://" + filePath)
 
-	lines := strings.Split(string(data), "\n")
-	lastLine := uint32(len(lines))
-
-	changes[fileUri] = []protocol.TextEdit{
-		{
-			Range: protocol.Range{
-				Start: protocol.Position{Line: 0, Character: 0},
-				End:   protocol.Position{Line: lastLine, Character: 0},
-			},
-			NewText: string(jsonData) + "\n",
-		},
-	}
+	changes[fileUri] = []protocol.TextEdit{*textEdit}
 
 	edit := protocol.WorkspaceEdit{
 		Changes: changes,
@@ -356,20 +365,8 @@ func createMethodCodeActionForClass(
 	}
 }
 
-func createMethodCodeAction(
-	errorInfo *ErrorInfo,
-	diagnostic protocol.Diagnostic,
-) *protocol.CodeAction {
-	return createMethodCodeActionForClass(errorInfo, diagnostic, errorInfo.ClassName)
-}
-
-func findBuiltinConfigDir() string {
-	cwd, err := os.Getwd()
-	if err != nil {
-		return ""
-	}
-
-	configDir := filepath.Join(cwd, ".ti-config")
+func findBuiltinConfigDir(scope *workspaceScope) string {
+	configDir := configDirPath(scope)
 	if stat, err := os.Stat(configDir); err == nil && stat.IsDir() {
 		return configDir
 	}
@@ -377,8 +374,8 @@ func findBuiltinConfigDir() string {
 	return ""
 }
 
-func findBuiltinJsonPath(className string) string {
-	configDir := findBuiltinConfigDir()
+func findBuiltinJsonPath(scope *workspaceScope, className string) string {
+	configDir := findBuiltinConfigDir(scope)
 
 	jsonPath := fmt.Sprintf("%s/%s.json", configDir, strings.ToLower(className))
 	if _, err := os.Stat(jsonPath); err == nil {
@@ -386,3 +383,100 @@ func findBuiltinJsonPath(className string) string {
 	}
 	return ""
 }
+
+// lineIndent returns the leading whitespace of the line containing offset
+func lineIndent(content string, offset int) string {
+	lineStart := strings.LastIndex(content[:offset], "\n") + 1
+
+	end := lineStart
+	for end < len(content) && (content[end] == ' ' || content[end] == '\t') {
+		end++
+	}
+
+	return content[lineStart:end]
+}
+
+// makeAppendToArrayEdit appends value to the top level array named section
+// as a minimal insertion, leaving the rest of the file untouched
+func makeAppendToArrayEdit(content string, section string, value any) *protocol.TextEdit {
+	root, jsonErr := parseJsonNode(content)
+	if jsonErr != nil || root == nil || root.Kind != JsonObject {
+		return nil
+	}
+
+	indentUnit := "  "
+	if len(root.Members) > 0 {
+		if indent := lineIndent(content, root.Members[0].KeyStart); indent != "" {
+			indentUnit = indent
+		}
+	}
+
+	array := root.Member(section)
+
+	var start, end int
+	var newText string
+
+	switch {
+	case array == nil:
+		// "section": [ value ] after the last member
+		itemIndent := indentUnit + indentUnit
+
+		data, err := json.MarshalIndent(value, itemIndent, indentUnit)
+		if err != nil {
+			return nil
+		}
+
+		newText = fmt.Sprintf(
+			"\"%s\": [\n%s%s\n%s]",
+			section,
+			itemIndent,
+			data,
+			indentUnit,
+		)
+
+		if len(root.Members) > 0 {
+			last := root.Members[len(root.Members)-1]
+			start = last.Value.End
+			newText = ",\n" + indentUnit + newText
+		} else {
+			start = root.Start + 1
+			newText = "\n" + indentUnit + newText + "\n"
+		}
+
+		end = start
+
+	case array.Kind != JsonArray:
+		return nil
+
+	case len(array.Items) == 0:
+		arrayIndent := lineIndent(content, array.Start)
+		itemIndent := arrayIndent + indentUnit
+
+		data, err := json.MarshalIndent(value, itemIndent, indentUnit)
+		if err != nil {
+			return nil
+		}
+
+		start = array.Start + 1
+		end = array.End - 1
+		newText = "\n" + itemIndent + string(data) + "\n" + arrayIndent
+
+	default:
+		last := array.Items[len(array.Items)-1]
+		itemIndent := lineIndent(content, last.Start)
+
+		data, err := json.MarshalIndent(value, itemIndent, indentUnit)
+		if err != nil {
+			return nil
+		}
+
+		start = last.End
+		end = last.End
+		newText = ",\n" + itemIndent + string(data)
+	}
+
+	return &protocol.TextEdit{
+		Range:   makeOffsetRange(content, start, end),
+		NewText: newText,
+	}
+}
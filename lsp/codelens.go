@@ -1,12 +1,9 @@
 package lsp
 
 import (
-	"context"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
@@ -42,7 +39,7 @@ func parseDefineInfo(line string) (*DefineInfo, error) {
 	}, nil
 }
 
-func getDefineInfos(content string) ([]DefineInfo, error) {
+func getDefineInfos(scope *workspaceScope, content string) ([]DefineInfo, error) {
 	tmpFile, err := os.CreateTemp("", "ruby-ti-lsp-*.rb")
 	if err != nil {
 		return nil, err
@@ -58,13 +55,14 @@ func getDefineInfos(content string) ([]DefineInfo, error) {
 		return nil, err
 	}
 
-	ctx, cancel :=
-		context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	ctx, cancel := tiTimeoutContext(scope)
 
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "ti", tmpFile.Name(), "-i")
-	output, err := cmd.CombinedOutput()
+	// the definitions are parsed from both streams, as ti may print them
+	// on stderr
+	cmd := tiCommand(scope, ctx, tmpFile.Name(), "-i")
+	output, err := runTiCombined(ctx, cmd)
 	if err != nil {
 		return []DefineInfo{}, nil
 	}
@@ -85,8 +83,8 @@ func getDefineInfos(content string) ([]DefineInfo, error) {
 	return infos, nil
 }
 
-func findCodeLens(content string) ([]protocol.CodeLens, error) {
-	infos, err := getDefineInfos(content)
+func findCodeLens(scope *workspaceScope, content string) ([]protocol.CodeLens, error) {
+	infos, err := getDefineInfos(scope, content)
 	if err != nil {
 		return nil, err
 	}
@@ -102,8 +100,9 @@ func findCodeLens(content string) ([]protocol.CodeLens, error) {
 				End:   protocol.Position{Line: line, Character: 0},
 			},
 			Command: &protocol.Command{
-				Title:   info.Signature,
-				Command: "ruby-ti.showSignature",
+				Title:     info.Signature,
+				Command:   "ruby-ti.showSignature",
+				Arguments: []any{info.Signature},
 			},
 		}
 
@@ -118,12 +117,18 @@ func textDocumentCodeLens(
 	params *protocol.CodeLensParams,
 ) ([]protocol.CodeLens, error) {
 
-	content, ok := documentContents[params.TextDocument.URI]
+	scope := findDocumentScope(params.TextDocument.URI)
+
+	if !getSettings(scope).Features.CodeLens {
+		return nil, nil
+	}
+
+	content, ok := getOpenDocument(params.TextDocument.URI)
 	if !ok {
 		return nil, nil
 	}
 
-	lenses, err := findCodeLens(content)
+	lenses, err := findCodeLens(scope, content)
 	if err != nil {
 		return nil, nil
 	}
@@ -0,0 +1,313 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+var (
+	tiMutex         sync.Mutex
+	tiCtx, tiCancel = context.WithCancel(context.Background())
+)
+
+// tiContext is the parent of every ti invocation, restartTi cancels it
+func tiContext() context.Context {
+	tiMutex.Lock()
+	defer tiMutex.Unlock()
+
+	return tiCtx
+}
+
+func argumentString(arguments []any, index int) (string, bool) {
+	if index >= len(arguments) {
+		return "", false
+	}
+
+	value, ok := arguments[index].(string)
+
+	return value, ok
+}
+
+func showMessage(ctx *glsp.Context, messageType protocol.MessageType, message string) {
+	ctx.Notify(protocol.ServerWindowShowMessage, protocol.ShowMessageParams{
+		Type:    messageType,
+		Message: message,
+	})
+}
+
+// applyWorkspaceEdit asks the client to apply edit. Handlers run on the
+// connection's read loop, so the request is sent without waiting
+func applyWorkspaceEdit(ctx *glsp.Context, label string, edit protocol.WorkspaceEdit) {
+	go func() {
+		var result protocol.ApplyWorkspaceEditResponse
+
+		ctx.Call(
+			protocol.ServerWorkspaceApplyEdit,
+			protocol.ApplyWorkspaceEditParams{Label: &label, Edit: edit},
+			&result,
+		)
+	}()
+}
+
+// generateConfig writes .ti-config JSON for the named class, or for every
+// class in the document when no class is given
+func generateConfig(ctx *glsp.Context, arguments []any) (any, error) {
+	uri, ok := argumentString(arguments, 0)
+	if !ok {
+		return nil, fmt.Errorf("ruby-ti.generateConfig expects a document uri")
+	}
+
+	className, _ := argumentString(arguments, 1)
+
+	scope := findDocumentScope(uri)
+
+	content := readWorkspaceFile(uriToPath(uri))
+
+	// the edits run ti for every class, keep them off the read loop
+	go func() {
+		for _, definition := range findRubyClassDefinitions(content) {
+			if className != "" && definition.Name != className {
+				continue
+			}
+
+			edit := makeGenerateConfigEdit(scope, content, definition)
+			if edit == nil {
+				continue
+			}
+
+			applyWorkspaceEdit(ctx, fmt.Sprintf("Generate .ti-config for '%s'", definition.Name), *edit)
+		}
+	}()
+
+	return nil, nil
+}
+
+// importRbsCommand converts the given .rbs files or directories into
+// .ti-config class files and logs what could not be translated
+func importRbsCommand(ctx *glsp.Context, arguments []any) (any, error) {
+	var paths []string
+
+	for _, argument := range arguments {
+		if path, ok := argument.(string); ok {
+			paths = append(paths, uriToPath(path))
+		}
+	}
+
+	// the classes go to the project of the first path
+	scope := findDefaultScope()
+	if len(paths) > 0 {
+		scope = findScope(paths[0])
+	}
+
+	if findBuiltinConfigDir(scope) == "" {
+		return nil, fmt.Errorf(".ti-config directory not found")
+	}
+
+	files := findRbsFiles(paths)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("ruby-ti.importRbs expects .rbs files or directories")
+	}
+
+	classConfigs, issues := importRbsFiles(files)
+
+	for _, classConfig := range classConfigs {
+		edit := makeClassConfigEdit(scope, classConfig)
+		if edit == nil {
+			continue
+		}
+
+		applyWorkspaceEdit(ctx, fmt.Sprintf("Import RBS for '%s'", classConfig.Class), *edit)
+	}
+
+	for _, issue := range issues {
+		ctx.Notify(protocol.ServerWindowLogMessage, protocol.LogMessageParams{
+			Type:    protocol.MessageTypeWarning,
+			Message: issue.String(),
+		})
+	}
+
+	return nil, nil
+}
+
+// exportRbsCommand writes every .ti-config class into an .rbs file, at
+// the given path or sig/ti-config.rbs
+func exportRbsCommand(ctx *glsp.Context, arguments []any) (any, error) {
+	path := ""
+	if argument, ok := argumentString(arguments, 0); ok {
+		path = uriToPath(argument)
+	}
+
+	scope := findDefaultScope()
+	if filepath.IsAbs(path) {
+		scope = findScope(filepath.Dir(path))
+	}
+
+	if findBuiltinConfigDir(scope) == "" {
+		return nil, fmt.Errorf(".ti-config directory not found")
+	}
+
+	if !supportsCreateFile {
+		return nil, fmt.Errorf("ruby-ti.exportRbs needs a client that can create files")
+	}
+
+	applyWorkspaceEdit(ctx, "Export .ti-config to RBS", makeRbsExportEdit(scope, resolveRbsExportPath(scope, path)))
+
+	return nil, nil
+}
+
+// showSignature is run from a code lens and shows its signature
+func showSignature(ctx *glsp.Context, arguments []any) (any, error) {
+	signature, ok := argumentString(arguments, 0)
+	if !ok {
+		return nil, fmt.Errorf("ruby-ti.showSignature expects a signature")
+	}
+
+	showMessage(ctx, protocol.MessageTypeInfo, signature)
+
+	return signature, nil
+}
+
+// rerunDiagnostics publishes fresh diagnostics for every open document. It
+// waits for ti, so commands run it off the connection's read loop
+func rerunDiagnostics(ctx *glsp.Context, arguments []any) (any, error) {
+	for uri, content := range getOpenDocuments() {
+		publishDiagnostics(ctx, uri, content)
+	}
+
+	return nil, nil
+}
+
+func rerunDiagnosticsCommand(ctx *glsp.Context, arguments []any) (any, error) {
+	go rerunDiagnostics(ctx, arguments)
+
+	return nil, nil
+}
+
+// restartTi kills the ti processes still running, drops what was cached
+// from their output and checks the open documents again
+func restartTi(ctx *glsp.Context, arguments []any) (any, error) {
+	tiMutex.Lock()
+	tiCancel()
+	tiCtx, tiCancel = context.WithCancel(context.Background())
+	tiMutex.Unlock()
+
+	completionCacheMutex.Lock()
+	clear(completionCache)
+	completionCacheMutex.Unlock()
+
+	receiverCacheMutex.Lock()
+	clear(receiverCache)
+	receiverCacheMutex.Unlock()
+
+	selfMethodCacheMutex.Lock()
+	clear(selfMethodCache)
+	selfMethodCacheMutex.Unlock()
+
+	resetTiStatus()
+
+	showMessage(ctx, protocol.MessageTypeInfo, "ruby-ti: restarted ti")
+
+	return rerunDiagnosticsCommand(ctx, arguments)
+}
+
+func toggleStrictMode(ctx *glsp.Context, arguments []any) (any, error) {
+	strict := !getBaseSettings().Strict
+	setStrictMode(strict)
+
+	state := "off"
+	if strict {
+		state = "on"
+	}
+
+	showMessage(ctx, protocol.MessageTypeInfo, "ruby-ti: strict mode "+state)
+
+	return rerunDiagnosticsCommand(ctx, arguments)
+}
+
+// showInferredType shows what ti infers on the line at the given position
+func showInferredType(ctx *glsp.Context, arguments []any) (any, error) {
+	uri, ok := argumentString(arguments, 0)
+	if !ok || len(arguments) < 2 {
+		return nil, fmt.Errorf("ruby-ti.showInferredType expects a document uri and position")
+	}
+
+	var position protocol.Position
+
+	data, err := json.Marshal(arguments[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &position); err != nil {
+		return nil, err
+	}
+
+	content, ok := getOpenDocument(uri)
+	if !ok {
+		return nil, fmt.Errorf("document %s is not open", uri)
+	}
+
+	scope := findDocumentScope(uri)
+
+	hover, _ := findHover(scope, content, &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     position,
+		},
+	})
+
+	var markup protocol.MarkupContent
+	if hover != nil {
+		markup, ok = hover.Contents.(protocol.MarkupContent)
+	}
+
+	if hover == nil || !ok {
+		showMessage(ctx, protocol.MessageTypeInfo, "ruby-ti: no type inferred here")
+		return nil, nil
+	}
+
+	inferred := markup.Value
+	showMessage(ctx, protocol.MessageTypeInfo, inferred)
+
+	return inferred, nil
+}
+
+// serverCommands are the workspace/executeCommand commands, all of them
+// advertised in the server capabilities
+var serverCommands = map[string]func(ctx *glsp.Context, arguments []any) (any, error){
+	"ruby-ti.showSignature":    showSignature,
+	"ruby-ti.rerunDiagnostics": rerunDiagnosticsCommand,
+	"ruby-ti.restartTi":        restartTi,
+	"ruby-ti.toggleStrictMode": toggleStrictMode,
+	"ruby-ti.showInferredType": showInferredType,
+	"ruby-ti.generateConfig":   generateConfig,
+	"ruby-ti.importRbs":        importRbsCommand,
+	"ruby-ti.exportRbs":        exportRbsCommand,
+	"ruby-ti.createConfig":     createConfigCommand,
+	"ruby-ti.addConfigMethod":  addConfigMethod,
+}
+
+func workspaceExecuteCommand(
+	ctx *glsp.Context,
+	params *protocol.ExecuteCommandParams,
+) (any, error) {
+
+	command, ok := serverCommands[params.Command]
+	if !ok {
+		return nil, fmt.Errorf("unknown command '%s'", params.Command)
+	}
+
+	return command(ctx, params.Arguments)
+}
+
+func serverCommandNames() []string {
+	return slices.Sorted(maps.Keys(serverCommands))
+}
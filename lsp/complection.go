@@ -2,12 +2,15 @@ package lsp
 
 import (
 	"bufio"
-	"context"
 	"fmt"
+	"hash/fnv"
+	"maps"
 	"os"
-	"os/exec"
+	"slices"
 	"strings"
-	"time"
+	"sync"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
 func removeAfterLastDot(content string, line uint32, character uint32) string {
@@ -82,7 +85,7 @@ func getSignatures(cmdOutput []byte) []Sig {
 	return responseSignatures
 }
 
-func findComplection(content string, line uint32, character uint32) []Sig {
+func findComplection(scope *workspaceScope, content string, line uint32, character uint32) []Sig {
 	content = removeAfterLastDot(content, line, character)
 
 	tmpFile, err := os.CreateTemp("", "ruby-ti-lsp-*.rb")
@@ -99,21 +102,20 @@ func findComplection(content string, line uint32, character uint32) []Sig {
 
 	tmpFile.Close()
 
-	ctx, cancel :=
-		context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	ctx, cancel := tiTimeoutContext(scope)
 
 	defer cancel()
 
 	cmd :=
-		exec.CommandContext(
+		tiCommand(
+			scope,
 			ctx,
-			"ti",
 			tmpFile.Name(),
 			"--suggest",
 			fmt.Sprintf("--row=%d", line+1),
 		)
 
-	output, err := cmd.Output()
+	output, err := runTi(ctx, cmd)
 	if err != nil {
 		return []Sig{}
 	}
@@ -121,12 +123,12 @@ func findComplection(content string, line uint32, character uint32) []Sig {
 	return getSignatures(output)
 }
 
-func getAllTypes() []string {
-	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+func getAllTypes(scope *workspaceScope) []string {
+	ctx, cancel := tiTimeoutContext(scope)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "ti", "--all-type")
-	output, err := cmd.Output()
+	cmd := tiCommand(scope, ctx, "--all-type")
+	output, err := runTi(ctx, cmd)
 	if err != nil {
 		return []string{}
 	}
@@ -143,43 +145,6 @@ func getAllTypes() []string {
 	return types
 }
 
-func isInTypeArray(content string, line uint32, character uint32) bool {
-	lines := strings.Split(content, "\n")
-	if int(line) >= len(lines) {
-		return false
-	}
-
-	currentLine := lines[line]
-	if int(character) > len(currentLine) {
-		return false
-	}
-
-	beforeCursor := currentLine[:character]
-
-	quoteCount := strings.Count(beforeCursor, "\"")
-	if quoteCount%2 == 0 {
-		return false
-	}
-
-	for i := int(line); i >= 0 && i >= int(line)-10; i-- {
-		checkLine := strings.TrimSpace(lines[i])
-		if strings.Contains(checkLine, "\"type\"") || strings.Contains(checkLine, `"type":`) {
-			for j := i; j <= int(line); j++ {
-				l := strings.TrimSpace(lines[j])
-				if strings.HasPrefix(l, "]") && j < int(line) {
-					return false
-				}
-			}
-			return true
-		}
-		if strings.HasPrefix(checkLine, "}") || strings.HasPrefix(checkLine, "{") {
-			return false
-		}
-	}
-
-	return false
-}
-
 func makeTypeDetail(typeName string) string {
 	typeDetails := map[string]string{
 		// Basic types
@@ -358,12 +323,8 @@ func makeTypeDocumentation(typeName string) string {
 	return doc
 }
 
-func findJsonTypeCompletion(content string, line uint32, character uint32) []Sig {
-	if !isInTypeArray(content, line, character) {
-		return []Sig{}
-	}
-
-	types := getAllTypes()
+func findTypeNameCompletion(scope *workspaceScope) []Sig {
+	types := getAllTypes(scope)
 	var signatures []Sig
 	for _, typeName := range types {
 		if typeName == "IntInt" {
@@ -374,6 +335,444 @@ func findJsonTypeCompletion(content string, line uint32, character uint32) []Sig
 			Method:        typeName,
 			Detail:        makeTypeDetail(typeName),
 			Documentation: makeTypeDocumentation(typeName),
+			Kind:          protocol.CompletionItemKindTypeParameter,
+		})
+	}
+
+	for _, classConfig := range loadClassConfigs(scope) {
+		if slices.Contains(types, classConfig.Class) {
+			continue
+		}
+
+		signatures = append(signatures, Sig{
+			Method: classConfig.Class,
+			Detail: classConfig.Frame + " class",
+			Kind:   protocol.CompletionItemKindClass,
+		})
+	}
+
+	return signatures
+}
+
+func findJsonKeyCompletion(cursor *JsonCursor) []Sig {
+	schema := configSchemas[cursor.Schema]
+
+	var signatures []Sig
+
+	for _, key := range slices.Sorted(maps.Keys(schema)) {
+		if cursor.Object.Member(key) != nil &&
+			(cursor.Member == nil || cursor.Member.Key != key) {
+
+			continue
+		}
+
+		signatures = append(signatures, Sig{
+			Method:        key,
+			Detail:        schema[key].Kind.String(),
+			Documentation: schema[key].Description,
+			Kind:          protocol.CompletionItemKindProperty,
+		})
+	}
+
+	return signatures
+}
+
+func findJsonValueCompletion(scope *workspaceScope, cursor *JsonCursor) []Sig {
+	field, ok := configSchemas[cursor.Schema][cursor.Member.Key]
+	if !ok {
+		return []Sig{}
+	}
+
+	switch {
+	case field.Kind == JsonBool:
+		return []Sig{
+			{Method: "true", Detail: "boolean", Kind: protocol.CompletionItemKindValue},
+			{Method: "false", Detail: "boolean", Kind: protocol.CompletionItemKindValue},
+		}
+
+	case field.IsTypeName:
+		return findTypeNameCompletion(scope)
+
+	case field.IsClassName:
+		var signatures []Sig
+
+		for _, classConfig := range loadClassConfigs(scope) {
+			signatures = append(signatures, Sig{
+				Method: classConfig.Class,
+				Detail: classConfig.Frame + " class",
+				Kind:   protocol.CompletionItemKindClass,
+			})
+		}
+
+		return signatures
+
+	case cursor.Schema == "class" && cursor.Member.Key == "frame":
+		frames := []string{"Builtin"}
+		for _, classConfig := range loadClassConfigs(scope) {
+			frames = appendUnique(frames, classConfig.Frame)
+		}
+
+		var signatures []Sig
+		for _, frame := range frames {
+			signatures = append(signatures, Sig{
+				Method: frame,
+				Detail: "frame",
+				Kind:   protocol.CompletionItemKindEnumMember,
+			})
+		}
+
+		return signatures
+	}
+
+	return []Sig{}
+}
+
+// findJsonCompletion completes property names and values in .ti-config
+func findJsonCompletion(scope *workspaceScope, content string, line uint32, character uint32) []Sig {
+	root, _ := parseJsonNode(content)
+
+	offset := positionToOffset(content, protocol.Position{Line: line, Character: character})
+
+	cursor := findJsonCursor(root, content, offset)
+	if cursor == nil {
+		return []Sig{}
+	}
+
+	var signatures []Sig
+	isStringValue := true
+
+	if cursor.InKey || cursor.Member == nil {
+		signatures = findJsonKeyCompletion(cursor)
+	} else {
+		signatures = findJsonValueCompletion(scope, cursor)
+		isStringValue = configSchemas[cursor.Schema][cursor.Member.Key].Kind != JsonBool
+	}
+
+	if !cursor.InString && isStringValue {
+		for i := range signatures {
+			signatures[i].Method = `"` + signatures[i].Method + `"`
+		}
+	}
+
+	return signatures
+}
+
+// getCompletionPrefix returns the identifier being typed at the cursor
+// and the character right before it (0 at the start of the line)
+func getCompletionPrefix(
+	content string,
+	line uint32,
+	character uint32,
+) (string, byte) {
+
+	lines := strings.Split(content, "\n")
+	if int(line) >= len(lines) {
+		return "", 0
+	}
+
+	currentLine := lines[line]
+	if int(character) < len(currentLine) {
+		currentLine = currentLine[:character]
+	}
+
+	start := len(currentLine)
+	for start > 0 && (isWordChar(currentLine[start-1]) || currentLine[start-1] == '@') {
+		start--
+	}
+
+	if start == 0 {
+		return currentLine, 0
+	}
+
+	return currentLine[start:], currentLine[start-1]
+}
+
+const selfMethodCacheSize = 64
+
+// selfMethodCache keeps what ti suggests on the implicit self for the
+// identifier being typed, every letter triggers completion but only the
+// first one of a word starts ti
+var (
+	selfMethodCache      = make(map[uint64][]Sig)
+	selfMethodCacheMutex sync.Mutex
+)
+
+// findSelfMethodCompletion asks ti for the methods callable without a
+// receiver, keyed by the document around the identifier at the cursor
+func findSelfMethodCompletion(scope *workspaceScope, content string, line uint32, character uint32) []Sig {
+	lines := strings.Split(content, "\n")
+	if int(line) >= len(lines) {
+		return []Sig{}
+	}
+
+	lineStart := len(strings.Join(lines[:line], "\n"))
+	if line > 0 {
+		lineStart++
+	}
+
+	cursor := lineStart + min(int(character), len(lines[line]))
+
+	prefix, _ := getCompletionPrefix(content, line, character)
+
+	hash := fnv.New64a()
+	hash.Write([]byte(scope.Root))
+	hash.Write([]byte{0})
+	hash.Write([]byte(content[:cursor-len(prefix)]))
+	hash.Write([]byte{0})
+	hash.Write([]byte(content[cursor:]))
+	key := hash.Sum64()
+
+	selfMethodCacheMutex.Lock()
+	signatures, ok := selfMethodCache[key]
+	selfMethodCacheMutex.Unlock()
+
+	if ok {
+		return signatures
+	}
+
+	signatures = findComplection(scope, content, line, character)
+
+	// a failed or timed out run is asked again on the next letter
+	if len(signatures) == 0 {
+		return signatures
+	}
+
+	selfMethodCacheMutex.Lock()
+	if len(selfMethodCache) >= selfMethodCacheSize {
+		clear(selfMethodCache)
+	}
+	selfMethodCache[key] = signatures
+	selfMethodCacheMutex.Unlock()
+
+	return signatures
+}
+
+func findIdentifierCompletion(scope *workspaceScope, content string, line uint32, character uint32) []Sig {
+	info := findScopeInfo(content, line, character)
+
+	var signatures []Sig
+
+	add := func(names []string, detail string, kind protocol.CompletionItemKind) {
+		for _, name := range names {
+			signatures = append(signatures, Sig{
+				Method: name,
+				Detail: detail,
+				Kind:   kind,
+			})
+		}
+	}
+
+	add(info.Locals, "local variable", protocol.CompletionItemKindVariable)
+	add(info.Params, "parameter", protocol.CompletionItemKindVariable)
+	add(info.BlockParams, "block parameter", protocol.CompletionItemKindVariable)
+	add(info.Ivars, "instance variable", protocol.CompletionItemKindField)
+
+	// ti knows the methods callable on the implicit self, the scan only
+	// adds the ones it could not type
+	inferred := make(map[string]bool)
+	for _, sig := range findSelfMethodCompletion(scope, content, line, character) {
+		inferred[sig.Method] = true
+
+		sig.Kind = protocol.CompletionItemKindMethod
+		signatures = append(signatures, sig)
+	}
+
+	for _, method := range info.Methods {
+		if !inferred[method] {
+			add([]string{method}, "method", protocol.CompletionItemKindMethod)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, constant := range info.Constants {
+		if seen[constant.Name] {
+			continue
+		}
+
+		seen[constant.Name] = true
+		signatures = append(signatures, makeConstantSig(constant))
+	}
+
+	add(rubyKeywords, "keyword", protocol.CompletionItemKindKeyword)
+
+	return signatures
+}
+
+// Foo::Bar:: -> Foo::Bar, false when the cursor does not follow ::
+func extractNamespaceBeforeCursor(
+	content string,
+	line uint32,
+	character uint32,
+) (string, bool) {
+
+	lines := strings.Split(content, "\n")
+	if int(line) >= len(lines) {
+		return "", false
+	}
+
+	currentLine := lines[line]
+	if int(character) < len(currentLine) {
+		currentLine = currentLine[:character]
+	}
+
+	end := len(currentLine)
+	for end > 0 && isWordChar(currentLine[end-1]) {
+		end--
+	}
+
+	if !strings.HasSuffix(currentLine[:end], "::") {
+		return "", false
+	}
+
+	end -= 2
+	start := end
+
+	for start > 0 {
+		if isWordChar(currentLine[start-1]) {
+			start--
+			continue
+		}
+
+		if start > 1 && currentLine[start-2:start] == "::" {
+			start -= 2
+			continue
+		}
+
+		break
+	}
+
+	return strings.TrimPrefix(currentLine[start:end], "::"), true
+}
+
+// resolveNamespaceCandidates lists the lexical lookups for name
+// App::Foo + Bar -> App::Foo::Bar, App::Bar, Bar
+func resolveNamespaceCandidates(current string, name string) []string {
+	var candidates []string
+
+	for current != "" {
+		candidates = append(candidates, current+"::"+name)
+		_, current = splitNamespace(current)
+	}
+
+	return append(candidates, name)
+}
+
+func makeConstantSig(constant RubyConstant) Sig {
+	switch {
+	case constant.IsClass:
+		return Sig{Method: constant.Name, Detail: "class", Kind: protocol.CompletionItemKindClass}
+	case constant.IsModule:
+		return Sig{Method: constant.Name, Detail: "module", Kind: protocol.CompletionItemKindModule}
+	default:
+		return Sig{Method: constant.Name, Detail: "constant", Kind: protocol.CompletionItemKindConstant}
+	}
+}
+
+func findNamespaceCompletion(scope *workspaceScope, content string, line uint32, character uint32) []Sig {
+	namespace, ok := extractNamespaceBeforeCursor(content, line, character)
+	if !ok {
+		return []Sig{}
+	}
+
+	info := findScopeInfo(content, line, character)
+	classConfigs := loadClassConfigs(scope)
+
+	var signatures []Sig
+	seen := make(map[string]bool)
+
+	add := func(sig Sig) {
+		if seen[sig.Method] {
+			return
+		}
+
+		seen[sig.Method] = true
+		signatures = append(signatures, sig)
+	}
+
+	for _, candidate := range resolveNamespaceCandidates(info.Namespace, namespace) {
+		for _, constant := range info.Constants {
+			if constant.Namespace == candidate {
+				add(makeConstantSig(constant))
+			}
+		}
+
+		for _, classConfig := range classConfigs {
+			name, parent := splitNamespace(classConfig.Class)
+			if parent == candidate {
+				add(Sig{
+					Method: name,
+					Detail: classConfig.Frame + " class",
+					Kind:   protocol.CompletionItemKindClass,
+				})
+			}
+
+			if classConfig.Class != candidate {
+				continue
+			}
+
+			for _, constant := range classConfig.Constants {
+				add(Sig{
+					Method: constant.Name,
+					Detail: strings.Join(constant.ReturnType.Type, " | "),
+					Kind:   protocol.CompletionItemKindConstant,
+				})
+			}
+		}
+
+		if len(signatures) > 0 {
+			break
+		}
+	}
+
+	// Foo:: -> Foo. so that ti suggests the class methods
+	lines := strings.Split(content, "\n")
+	if int(line) < len(lines) && namespace != "" {
+		currentLine := lines[line]
+		if int(character) < len(currentLine) {
+			currentLine = currentLine[:character]
+		}
+
+		if idx := strings.LastIndex(currentLine, "::"); idx != -1 {
+			lines[line] = currentLine[:idx] + "."
+			dotContent := strings.Join(lines, "\n")
+
+			for _, sig := range findComplection(scope, dotContent, line, uint32(idx+1)) {
+				sig.Kind = protocol.CompletionItemKindMethod
+				add(sig)
+			}
+		}
+	}
+
+	return signatures
+}
+
+func findConstantCompletion(scope *workspaceScope, content string, line uint32, character uint32) []Sig {
+	info := findScopeInfo(content, line, character)
+
+	var signatures []Sig
+	seen := make(map[string]bool)
+
+	for _, constant := range info.Constants {
+		if seen[constant.Name] {
+			continue
+		}
+
+		seen[constant.Name] = true
+		signatures = append(signatures, makeConstantSig(constant))
+	}
+
+	for _, classConfig := range loadClassConfigs(scope) {
+		name := strings.SplitN(classConfig.Class, "::", 2)[0]
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+
+		signatures = append(signatures, Sig{
+			Method: name,
+			Detail: classConfig.Frame + " class",
+			Kind:   protocol.CompletionItemKindClass,
 		})
 	}
 
@@ -0,0 +1,140 @@
+package lsp
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// configDirPath is the .ti-config directory configured for scope, relative
+// paths are resolved against its root
+func configDirPath(scope *workspaceScope) string {
+	configDir := getSettings(scope).ConfigDir
+	if filepath.IsAbs(configDir) {
+		return configDir
+	}
+
+	return filepath.Join(scope.Root, configDir)
+}
+
+// loadClassConfigFiles reads every class definition in .ti-config
+// keyed by its file path
+func loadClassConfigFiles(scope *workspaceScope) map[string]TiClassConfig {
+	classConfigs := make(map[string]TiClassConfig)
+
+	configDir := findBuiltinConfigDir(scope)
+	if configDir == "" {
+		return classConfigs
+	}
+
+	paths, err := filepath.Glob(filepath.Join(configDir, "*.json"))
+	if err != nil {
+		return classConfigs
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var classConfig TiClassConfig
+		if err := json.Unmarshal(data, &classConfig); err != nil {
+			continue
+		}
+
+		if classConfig.Class == "" {
+			continue
+		}
+
+		classConfigs[path] = classConfig
+	}
+
+	return classConfigs
+}
+
+func loadClassConfigs(scope *workspaceScope) []TiClassConfig {
+	classConfigFiles := loadClassConfigFiles(scope)
+
+	paths := slices.Sorted(maps.Keys(classConfigFiles))
+
+	classConfigs := make([]TiClassConfig, 0, len(paths))
+	for _, path := range paths {
+		classConfigs = append(classConfigs, classConfigFiles[path])
+	}
+
+	return classConfigs
+}
+
+func isConfigJsonFile(scope *workspaceScope, uri protocol.DocumentUri) bool {
+	configDir := findBuiltinConfigDir(scope)
+	if configDir == "" || !isJsonFile(uri) {
+		return false
+	}
+
+	return filepath.Dir(uriToPath(uri)) == configDir
+}
+
+// Foo::Bar::Baz -> Baz, Foo::Bar
+func splitNamespace(className string) (string, string) {
+	idx := strings.LastIndex(className, "::")
+	if idx == -1 {
+		return className, ""
+	}
+
+	return className[idx+2:], className[:idx]
+}
+
+// formatTiMethodSignature renders a TiMethod the way it reads in Ruby
+// def self.new(Int, key: String, *Untyped) { |Int| } -> Foo
+func formatTiMethodSignature(method TiMethod, isClassMethod bool) string {
+	var args []string
+
+	for _, argument := range method.Arguments {
+		types := strings.Join(argument.Type, " | ")
+
+		switch {
+		case argument.Key != "":
+			args = append(args, argument.Key+": "+types)
+		case argument.IsAsterisk:
+			args = append(args, "*"+types)
+		default:
+			args = append(args, types)
+		}
+	}
+
+	var builder strings.Builder
+
+	builder.WriteString("def ")
+	if isClassMethod {
+		builder.WriteString("self.")
+	}
+
+	builder.WriteString(method.Name)
+
+	if len(args) > 0 {
+		builder.WriteString("(" + strings.Join(args, ", ") + ")")
+	}
+
+	if len(method.BlockParameters) > 0 {
+		builder.WriteString(" { |" + strings.Join(method.BlockParameters, ", ") + "| }")
+	}
+
+	returnTypes := method.ReturnType.Type
+	if len(returnTypes) == 0 {
+		returnTypes = []string{"Untyped"}
+	}
+
+	if method.ReturnType.IsConditional {
+		returnTypes = appendUnique(slices.Clone(returnTypes), "NilClass")
+	}
+
+	builder.WriteString(" -> " + strings.Join(returnTypes, " | "))
+
+	return builder.String()
+}
@@ -0,0 +1,398 @@
+package lsp
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// ConfigField describes one property of a .ti-config JSON object
+type ConfigField struct {
+	Kind        JsonKind
+	Items       JsonKind
+	Schema      string
+	IsRequired  bool
+	IsTypeName  bool
+	IsClassName bool
+	Description string
+}
+
+var configSchemas = map[string]map[string]ConfigField{
+	"class": {
+		"frame": {
+			Kind:        JsonString,
+			IsRequired:  true,
+			Description: "Frame (namespace) the class belongs to, usually `Builtin`.",
+		},
+		"class": {
+			Kind:        JsonString,
+			IsRequired:  true,
+			Description: "Name of the class.",
+		},
+		"extends": {
+			Kind:        JsonArray,
+			Items:       JsonString,
+			IsClassName: true,
+			Description: "Classes whose methods are inherited.",
+		},
+		"instance_methods": {
+			Kind:        JsonArray,
+			Items:       JsonObject,
+			Schema:      "method",
+			Description: "Methods callable on instances.",
+		},
+		"class_methods": {
+			Kind:        JsonArray,
+			Items:       JsonObject,
+			Schema:      "method",
+			Description: "Methods callable on the class itself.",
+		},
+		"constants": {
+			Kind:        JsonArray,
+			Items:       JsonObject,
+			Schema:      "constant",
+			Description: "Constants defined under the class.",
+		},
+	},
+	"method": {
+		"name": {
+			Kind:        JsonString,
+			IsRequired:  true,
+			Description: "Method name.",
+		},
+		"arguments": {
+			Kind:        JsonArray,
+			Items:       JsonObject,
+			Schema:      "argument",
+			Description: "Positional and keyword arguments in order.",
+		},
+		"block_parameters": {
+			Kind:        JsonArray,
+			Items:       JsonString,
+			IsTypeName:  true,
+			Description: "Types yielded to the block.",
+		},
+		"return_type": {
+			Kind:        JsonObject,
+			Schema:      "return_type",
+			Description: "Type returned by the method.",
+		},
+		"document": {
+			Kind:        JsonString,
+			Description: "Markdown documentation shown on hover and completion.",
+		},
+	},
+	"argument": {
+		"type": {
+			Kind:        JsonArray,
+			Items:       JsonString,
+			IsRequired:  true,
+			IsTypeName:  true,
+			Description: "Accepted types of the argument.",
+		},
+		"key": {
+			Kind:        JsonString,
+			Description: "Keyword name when this is a keyword argument.",
+		},
+		"is_asterisk": {
+			Kind:        JsonBool,
+			Description: "Whether this is a splat (`*args`) argument.",
+		},
+	},
+	"return_type": {
+		"type": {
+			Kind:        JsonArray,
+			Items:       JsonString,
+			IsRequired:  true,
+			IsTypeName:  true,
+			Description: "Returned types.",
+		},
+		"is_conditional": {
+			Kind:        JsonBool,
+			Description: "Whether the method may also return nil.",
+		},
+		"is_destructive": {
+			Kind:        JsonBool,
+			Description: "Whether the method mutates the receiver.",
+		},
+	},
+	"constant": {
+		"name": {
+			Kind:        JsonString,
+			IsRequired:  true,
+			Description: "Constant name.",
+		},
+		"return_type": {
+			Kind:        JsonObject,
+			Schema:      "return_type",
+			Description: "Type of the constant.",
+		},
+	},
+}
+
+type configValidator struct {
+	content      string
+	knownTypes   []string
+	knownClasses []string
+	diagnostics  []protocol.Diagnostic
+}
+
+func (validator *configValidator) report(
+	start int,
+	end int,
+	severity protocol.DiagnosticSeverity,
+	message string,
+) {
+
+	validator.diagnostics = append(validator.diagnostics, protocol.Diagnostic{
+		Range:    makeOffsetRange(validator.content, start, end),
+		Severity: &severity,
+		Source:   &[]string{"ruby-ti"}[0],
+		Message:  message,
+	})
+}
+
+func (validator *configValidator) validateObject(node *JsonNode, schemaName string) {
+	schema := configSchemas[schemaName]
+
+	for _, member := range node.Members {
+		field, ok := schema[member.Key]
+		if !ok {
+			validator.report(
+				member.KeyStart,
+				member.KeyEnd,
+				protocol.DiagnosticSeverityWarning,
+				fmt.Sprintf("unknown key '%s' in %s", member.Key, strings.ReplaceAll(schemaName, "_", " ")),
+			)
+
+			continue
+		}
+
+		validator.validateValue(member.Value, field)
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(schema)) {
+		if schema[key].IsRequired && node.Member(key) == nil {
+			validator.report(
+				node.Start,
+				node.Start+1,
+				protocol.DiagnosticSeverityError,
+				fmt.Sprintf("missing required key '%s' in %s", key, strings.ReplaceAll(schemaName, "_", " ")),
+			)
+		}
+	}
+}
+
+func (validator *configValidator) validateValue(node *JsonNode, field ConfigField) {
+	if node == nil {
+		return
+	}
+
+	if node.Kind != field.Kind {
+		validator.report(
+			node.Start,
+			node.End,
+			protocol.DiagnosticSeverityError,
+			fmt.Sprintf("expected %s but got %s", field.Kind, node.Kind),
+		)
+
+		return
+	}
+
+	switch node.Kind {
+	case JsonObject:
+		validator.validateObject(node, field.Schema)
+
+	case JsonArray:
+		for _, item := range node.Items {
+			if item.Kind != field.Items {
+				validator.report(
+					item.Start,
+					item.End,
+					protocol.DiagnosticSeverityError,
+					fmt.Sprintf("expected %s but got %s", field.Items, item.Kind),
+				)
+
+				continue
+			}
+
+			switch {
+			case field.Schema != "":
+				validator.validateObject(item, field.Schema)
+			case field.IsTypeName:
+				validator.validateTypeName(item)
+			case field.IsClassName:
+				validator.validateClassName(item)
+			}
+		}
+
+		if field.Schema != "" {
+			validator.validateDuplicateNames(node)
+		}
+	}
+}
+
+func (validator *configValidator) validateTypeName(node *JsonNode) {
+	if len(validator.knownTypes) == 0 {
+		return
+	}
+
+	if slices.Contains(validator.knownTypes, node.Value) ||
+		slices.Contains(validator.knownClasses, node.Value) {
+
+		return
+	}
+
+	validator.report(
+		node.Start,
+		node.End,
+		protocol.DiagnosticSeverityError,
+		fmt.Sprintf("unknown type '%s'", node.Value),
+	)
+}
+
+func (validator *configValidator) validateClassName(node *JsonNode) {
+	if len(validator.knownTypes) == 0 {
+		return
+	}
+
+	if slices.Contains(validator.knownClasses, node.Value) ||
+		slices.Contains(validator.knownTypes, node.Value) {
+
+		return
+	}
+
+	validator.report(
+		node.Start,
+		node.End,
+		protocol.DiagnosticSeverityError,
+		fmt.Sprintf("extends class '%s' is not defined", node.Value),
+	)
+}
+
+func (validator *configValidator) validateDuplicateNames(node *JsonNode) {
+	seen := make(map[string]bool)
+
+	for _, item := range node.Items {
+		name := item.Member("name")
+		if name == nil || name.Kind != JsonString {
+			continue
+		}
+
+		if seen[name.Value] {
+			validator.report(
+				name.Start,
+				name.End,
+				protocol.DiagnosticSeverityError,
+				fmt.Sprintf("duplicate name '%s'", name.Value),
+			)
+
+			continue
+		}
+
+		seen[name.Value] = true
+	}
+}
+
+// validateClassFile checks the class against the file name and other files
+func (validator *configValidator) validateClassFile(
+	root *JsonNode,
+	path string,
+	otherConfigs map[string]TiClassConfig,
+) {
+
+	class := root.Member("class")
+	if class == nil || class.Kind != JsonString {
+		return
+	}
+
+	expectedName := strings.ToLower(class.Value) + ".json"
+	if filepath.Base(path) != expectedName {
+		validator.report(
+			class.Start,
+			class.End,
+			protocol.DiagnosticSeverityWarning,
+			fmt.Sprintf(
+				"class '%s' does not match file name '%s' (expected '%s')",
+				class.Value,
+				filepath.Base(path),
+				expectedName,
+			),
+		)
+	}
+
+	frame := root.Member("frame")
+	if frame == nil || frame.Kind != JsonString {
+		return
+	}
+
+	for otherPath, classConfig := range otherConfigs {
+		if otherPath == path || classConfig.Class != class.Value {
+			continue
+		}
+
+		if classConfig.Frame != frame.Value {
+			validator.report(
+				frame.Start,
+				frame.End,
+				protocol.DiagnosticSeverityWarning,
+				fmt.Sprintf(
+					"class '%s' is declared with frame '%s' in %s",
+					class.Value,
+					classConfig.Frame,
+					filepath.Base(otherPath),
+				),
+			)
+		}
+	}
+}
+
+// validateConfigJson publishes problems in a .ti-config class file
+func validateConfigJson(scope *workspaceScope, uri protocol.DocumentUri, content string) []protocol.Diagnostic {
+	validator := &configValidator{content: content}
+
+	root, jsonErr := parseJsonNode(content)
+	if jsonErr != nil {
+		validator.report(
+			jsonErr.Offset,
+			jsonErr.Offset+1,
+			protocol.DiagnosticSeverityError,
+			"malformed JSON: "+jsonErr.Message,
+		)
+
+		return validator.diagnostics
+	}
+
+	if root.Kind != JsonObject {
+		validator.report(
+			root.Start,
+			root.End,
+			protocol.DiagnosticSeverityError,
+			fmt.Sprintf("expected object but got %s", root.Kind),
+		)
+
+		return validator.diagnostics
+	}
+
+	path := uriToPath(uri)
+	otherConfigs := loadClassConfigFiles(scope)
+
+	validator.knownTypes = getAllTypes(scope)
+
+	for _, classConfig := range otherConfigs {
+		validator.knownClasses = appendUnique(validator.knownClasses, classConfig.Class)
+	}
+
+	if class := root.Member("class"); class != nil && class.Kind == JsonString {
+		validator.knownClasses = appendUnique(validator.knownClasses, class.Value)
+	}
+
+	validator.validateObject(root, "class")
+	validator.validateClassFile(root, path, otherConfigs)
+
+	return validator.diagnostics
+}
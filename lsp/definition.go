@@ -1,14 +1,12 @@
 package lsp
 
 import (
-	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
 	"slices"
 	"strings"
-	"time"
 
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
@@ -100,6 +98,7 @@ func isWordChar(b byte) bool {
 }
 
 func findDefinition(
+	scope *workspaceScope,
 	content string,
 	params *protocol.DefinitionParams,
 ) (any, error) {
@@ -136,7 +135,7 @@ func findDefinition(
 	tmpFile.Close()
 
 	prefixInfo, definitions, inheritanceMap :=
-		getTiOutForDefinition(tmpFile.Name(), int(params.Position.Line)+1)
+		getTiOutForDefinition(scope, tmpFile.Name(), int(params.Position.Line)+1)
 
 	if prefixInfo == "" {
 		return nil, nil
@@ -181,11 +180,11 @@ func findDefinition(
 
 			targetURI := params.TextDocument.URI
 			if !strings.Contains(defFilename, "ruby-ti-lsp-") {
-				workingDir, err := os.Getwd()
-				if err != nil {
-					workingDir = "."
+				absolutePath := defFilename
+				if !filepath.IsAbs(absolutePath) {
+					// ti reports files relative to its working directory
+					absolutePath = filepath.Join(scope.Root, defFilename)
 				}
-				absolutePath := filepath.Join(workingDir, defFilename)
 				targetURI = protocol.DocumentUri("file://" + absolutePath)
 			}
 
@@ -212,37 +211,134 @@ func findDefinition(
 		// "JSON.parse" -> "JSON"
 		parts := strings.Split(targetCode, ".")
 		className = parts[0]
+	} else if targetCode[0] < 'A' || targetCode[0] > 'Z' {
+		// bare method call on self
+		className = ""
+	} else {
+		// the class name itself
+		methodName = ""
 	}
 
-	jsonPath := findBuiltinJsonPath(className)
-	if jsonPath != "" {
-		location := protocol.Location{
-			URI: protocol.DocumentUri("file://" + jsonPath),
-			Range: protocol.Range{
-				Start: protocol.Position{Line: 0, Character: 0},
-				End:   protocol.Position{Line: 0, Character: 0},
-			},
+	isClassMethod := className != "" && className[0] >= 'A' && className[0] <= 'Z'
+
+	// the receiver text first (JSON.parse), then the class ti inferred for it
+	for _, candidate := range []string{className, searchClass} {
+		location :=
+			findConfigEntryLocation(scope, candidate, methodName, isClassMethod, make(map[string]bool))
+
+		if location != nil {
+			return *location, nil
+		}
+	}
+
+	if className == "" {
+		return nil, nil
+	}
+
+	for _, candidate := range []string{className, searchClass} {
+		if location := findClassJsonLocation(scope, candidate); location != nil {
+			return *location, nil
+		}
+
+		jsonPath := findBuiltinJsonPath(scope, candidate)
+		if jsonPath != "" {
+			return makeLocation(jsonPath, protocol.Range{}), nil
 		}
-		return location, nil
 	}
 
 	return nil, nil
 }
 
+// findConfigEntryLocation returns the range of the instance_methods,
+// class_methods or constants entry named name, following extends
+func findConfigEntryLocation(
+	scope *workspaceScope,
+	className string,
+	name string,
+	isClassMethod bool,
+	visited map[string]bool,
+) *protocol.Location {
+
+	if className == "" || name == "" || visited[className] {
+		return nil
+	}
+
+	visited[className] = true
+
+	jsonPath := ""
+	for path, classConfig := range loadClassConfigFiles(scope) {
+		if classConfig.Class == className {
+			jsonPath = path
+			break
+		}
+	}
+
+	if jsonPath == "" {
+		jsonPath = findBuiltinJsonPath(scope, className)
+	}
+
+	if jsonPath == "" {
+		return nil
+	}
+
+	content := readWorkspaceFile(jsonPath)
+
+	root, _ := parseJsonNode(content)
+	if root == nil {
+		return nil
+	}
+
+	sections := []string{"instance_methods", "class_methods", "constants"}
+	if isClassMethod {
+		sections = []string{"class_methods", "constants", "instance_methods"}
+	}
+
+	for _, section := range sections {
+		entries := root.Member(section)
+		if entries == nil || entries.Kind != JsonArray {
+			continue
+		}
+
+		for _, entry := range entries.Items {
+			entryName := entry.Member("name")
+			if entryName == nil || entryName.Value != name {
+				continue
+			}
+
+			location := makeLocation(jsonPath, makeOffsetRange(content, entry.Start, entry.End))
+			return &location
+		}
+	}
+
+	extends := root.Member("extends")
+	if extends == nil || extends.Kind != JsonArray {
+		return nil
+	}
+
+	for _, parent := range extends.Items {
+		location := findConfigEntryLocation(scope, parent.Value, name, isClassMethod, visited)
+		if location != nil {
+			return location
+		}
+	}
+
+	return nil
+}
+
 // gets type info and all method definitions and inheritance info by ti --define
 func getTiOutForDefinition(
+	scope *workspaceScope,
 	filename string,
 	row int,
 ) (string, []string, map[ClassNode][]ClassNode) {
 
-	ctx, cancel :=
-		context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	ctx, cancel := tiTimeoutContext(scope)
 	defer cancel()
 
 	cmd :=
-		exec.CommandContext(ctx, "ti", filename, "--define", fmt.Sprintf("--row=%d", row))
+		tiCommand(scope, ctx, filename, "--define", fmt.Sprintf("--row=%d", row))
 
-	output, err := cmd.Output()
+	output, err := runTi(ctx, cmd)
 	if err != nil {
 		return "", nil, make(map[ClassNode][]ClassNode)
 	}
@@ -321,3 +417,135 @@ func isMethodMatch(
 
 	return isParentClass(searchFrame, searchClass, defClass, inheritanceMap)
 }
+
+func makeLocation(path string, lineRange protocol.Range) protocol.Location {
+	return protocol.Location{
+		URI:   protocol.DocumentUri("file://" + path),
+		Range: lineRange,
+	}
+}
+
+// findClassJsonLocation returns the "class" value of className's config file
+func findClassJsonLocation(scope *workspaceScope, className string) *protocol.Location {
+	for path, classConfig := range loadClassConfigFiles(scope) {
+		if classConfig.Class != className {
+			continue
+		}
+
+		content := readWorkspaceFile(path)
+
+		root, _ := parseJsonNode(content)
+		if class := root.Member("class"); class != nil {
+			location := makeLocation(path, makeOffsetRange(content, class.Start, class.End))
+			return &location
+		}
+
+		location := makeLocation(path, protocol.Range{})
+		return &location
+	}
+
+	return nil
+}
+
+// findRubyClassLocations greps the workspace for class/module definitions
+func findRubyClassLocations(scope *workspaceScope, className string) []protocol.Location {
+	name, _ := splitNamespace(className)
+
+	pattern, err :=
+		regexp.Compile(`^\s*(?:class|module)\s+(?:[\w:]*::)?(` + regexp.QuoteMeta(name) + `)\b`)
+	if err != nil {
+		return nil
+	}
+
+	var locations []protocol.Location
+
+	for _, path := range findWorkspaceRubyFiles(scope) {
+		for row, line := range strings.Split(readWorkspaceFile(path), "\n") {
+			loc := pattern.FindStringSubmatchIndex(line)
+			if loc == nil {
+				continue
+			}
+
+			locations = append(locations, makeLocation(path, protocol.Range{
+				Start: protocol.Position{Line: uint32(row), Character: uint32(loc[2])},
+				End:   protocol.Position{Line: uint32(row), Character: uint32(loc[3])},
+			}))
+		}
+	}
+
+	return locations
+}
+
+// findRubyCallSites greps the workspace for calls of methodName
+func findRubyCallSites(scope *workspaceScope, methodName string) []protocol.Location {
+	name := strings.TrimSuffix(methodName, "=")
+	if name == "" || !isWordChar(name[0]) {
+		return nil
+	}
+
+	suffix := `(?:[^\w?!=]|$)`
+	if name != methodName {
+		suffix = `\s*=(?:[^=~>]|$)`
+	}
+
+	pattern, err := regexp.Compile(`(?:\.|::)(` + regexp.QuoteMeta(name) + `)` + suffix)
+	if err != nil {
+		return nil
+	}
+
+	var locations []protocol.Location
+
+	for _, path := range findWorkspaceRubyFiles(scope) {
+		for row, line := range strings.Split(readWorkspaceFile(path), "\n") {
+			for _, loc := range pattern.FindAllStringSubmatchIndex(stripRubyLine(line), -1) {
+				locations = append(locations, makeLocation(path, protocol.Range{
+					Start: protocol.Position{Line: uint32(row), Character: uint32(loc[2])},
+					End:   protocol.Position{Line: uint32(row), Character: uint32(loc[3])},
+				}))
+			}
+		}
+	}
+
+	return locations
+}
+
+// findJsonDefinition jumps from .ti-config JSON to classes and call sites
+func findJsonDefinition(
+	scope *workspaceScope,
+	content string,
+	params *protocol.DefinitionParams,
+) (any, error) {
+
+	root, _ := parseJsonNode(content)
+	offset := positionToOffset(content, params.Position)
+
+	cursor := findJsonCursor(root, content, offset)
+	if cursor == nil || cursor.InKey || cursor.Node == nil || cursor.Node.Kind != JsonString {
+		return nil, nil
+	}
+
+	field := configSchemas[cursor.Schema][cursor.Member.Key]
+
+	var locations []protocol.Location
+
+	switch {
+	case field.IsTypeName, field.IsClassName:
+		if location := findClassJsonLocation(scope, cursor.Node.Value); location != nil {
+			locations = append(locations, *location)
+		}
+
+		locations = append(locations, findRubyClassLocations(scope, cursor.Node.Value)...)
+
+	case cursor.Schema == "class" && cursor.Member.Key == "class":
+		locations = findRubyClassLocations(scope, cursor.Node.Value)
+
+	case cursor.Schema == "method" && cursor.Member.Key == "name":
+		locations = findRubyCallSites(scope, cursor.Node.Value)
+	}
+
+	if len(locations) == 0 {
+		return nil, nil
+	}
+
+	return locations, nil
+}
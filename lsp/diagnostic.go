@@ -2,18 +2,14 @@ package lsp
 
 import (
 	"bufio"
-	"context"
 	"os"
-	"os/exec"
-	"ruby-ti-lsp/cmd"
 	"strconv"
 	"strings"
-	"time"
 
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
-func runDiagnostics(content string) []protocol.Diagnostic {
+func runDiagnostics(scope *workspaceScope, content string) []protocol.Diagnostic {
 	tmpFile, err := os.CreateTemp("", "ruby-ti-lsp-*.rb")
 	if err != nil {
 		return []protocol.Diagnostic{}
@@ -28,18 +24,17 @@ func runDiagnostics(content string) []protocol.Diagnostic {
 
 	tmpFile.Close()
 
-	ctx, cancel :=
-		context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	ctx, cancel := tiTimeoutContext(scope)
 	defer cancel()
 
 	args := []string{tmpFile.Name()}
-	if cmd.IsStrictMode {
+	if getSettings(scope).Strict {
 		args = append(args, "--strict")
 	}
 
-	tiCmd := exec.CommandContext(ctx, "ti", args...)
+	tiCmd := tiCommand(scope, ctx, args...)
 
-	output, _ := tiCmd.Output()
+	output, _ := runTi(ctx, tiCmd)
 
 	return parseErrorsFromTiOutput(string(output))
 }
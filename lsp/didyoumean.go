@@ -0,0 +1,319 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const maxSuggestions = 3
+
+func levenshteinDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// findClosestNames returns up to maxSuggestions candidates near name
+func findClosestNames(name string, candidates []string) []string {
+	limit := max(2, len(name)/3)
+
+	type scored struct {
+		name     string
+		distance int
+	}
+
+	var matches []scored
+
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+
+		distance := levenshteinDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if distance <= limit {
+			matches = append(matches, scored{candidate, distance})
+		}
+	}
+
+	slices.SortFunc(matches, func(a, b scored) int {
+		if a.distance != b.distance {
+			return a.distance - b.distance
+		}
+
+		return strings.Compare(a.name, b.name)
+	})
+
+	var names []string
+	for _, match := range matches {
+		names = appendUnique(names, match.name)
+
+		if len(names) == maxSuggestions {
+			break
+		}
+	}
+
+	return names
+}
+
+// collectConfigMethodNames lists methods of className and its extends
+func collectConfigMethodNames(
+	classConfigs []TiClassConfig,
+	className string,
+	isClassMethod bool,
+	visited map[string]bool,
+) []string {
+
+	if visited[className] {
+		return nil
+	}
+
+	visited[className] = true
+
+	var names []string
+
+	for _, classConfig := range classConfigs {
+		if classConfig.Class != className {
+			continue
+		}
+
+		methods := classConfig.InstanceMethods
+		if isClassMethod {
+			methods = classConfig.ClassMethods
+		}
+
+		for _, method := range methods {
+			names = appendUnique(names, method.Name)
+		}
+
+		for _, parentClass := range classConfig.Extends {
+			names = appendUnique(
+				names,
+				collectConfigMethodNames(classConfigs, parentClass, isClassMethod, visited)...,
+			)
+		}
+	}
+
+	return names
+}
+
+func findMethodCandidates(scope *workspaceScope, content string, errorInfo *ErrorInfo) ([]string, *CallSite) {
+	lines := strings.Split(content, "\n")
+	if int(errorInfo.Line) >= len(lines) {
+		return nil, nil
+	}
+
+	line := lines[errorInfo.Line]
+
+	call := findCallSite(line, errorInfo.MethodName)
+	if call == nil {
+		return nil, nil
+	}
+
+	candidates := collectConfigMethodNames(
+		loadClassConfigs(scope),
+		errorInfo.ClassName,
+		errorInfo.MethodType == "class",
+		make(map[string]bool),
+	)
+
+	if call.Start > 0 && line[call.Start-1] == '.' {
+		// ask ti what the receiver responds to
+		for _, sig := range findComplection(scope, content, errorInfo.Line, uint32(call.Start)) {
+			candidates = appendUnique(candidates, sig.Method)
+		}
+	} else {
+		info := findScopeInfo(content, errorInfo.Line, uint32(call.Start))
+		candidates = appendUnique(candidates, info.Methods...)
+		candidates = appendUnique(candidates, info.Locals...)
+		candidates = appendUnique(candidates, info.Params...)
+	}
+
+	return candidates, call
+}
+
+// findClassCandidates returns the known class names and the span of the
+// whole constant path written for the misspelled class, Foo::Ba and not
+// only Ba, so a namespaced suggestion replaces all of it
+func findClassCandidates(scope *workspaceScope, content string, errorInfo *ErrorInfo) ([]string, int, int) {
+	lines := strings.Split(content, "\n")
+	if int(errorInfo.Line) >= len(lines) {
+		return nil, -1, -1
+	}
+
+	name, _ := splitNamespace(errorInfo.ClassName)
+
+	pattern := regexp.MustCompile(`(?:^|[^\w:])(?:::)?((?:[A-Z]\w*::)*` + regexp.QuoteMeta(name) + `)\b`)
+
+	matches := pattern.FindStringSubmatchIndex(stripRubyLine(lines[errorInfo.Line]))
+	if matches == nil {
+		return nil, -1, -1
+	}
+
+	loc := matches[2:4]
+
+	candidates := getAllTypes(scope)
+
+	for _, classConfig := range loadClassConfigs(scope) {
+		candidates = appendUnique(candidates, classConfig.Class)
+	}
+
+	for _, constant := range findScopeInfo(content, errorInfo.Line, uint32(loc[0])).Constants {
+		candidates = appendUnique(candidates, constant.Name)
+	}
+
+	return candidates, loc[0], loc[1]
+}
+
+// DidYouMeanData travels in the data of an undefined method or class
+// diagnostic: the span of the misspelled name and the closest known names.
+// Looking them up can take a ti run, so it is done while diagnostics are
+// published and not on every code action request
+type DidYouMeanData struct {
+	Range       protocol.Range `json:"range"`
+	Suggestions []string       `json:"suggestions"`
+}
+
+// findDidYouMean looks up the closest known names for the misspelled
+// method or class of errorInfo
+func findDidYouMean(scope *workspaceScope, content string, errorInfo *ErrorInfo) *DidYouMeanData {
+	var name string
+	var candidates []string
+	var start, end int
+
+	switch errorInfo.ErrorType {
+	case "method":
+		var call *CallSite
+
+		candidates, call = findMethodCandidates(scope, content, errorInfo)
+		if call == nil {
+			return nil
+		}
+
+		name = errorInfo.MethodName
+		start = call.Start
+		end = call.Start + len(name)
+
+	case "class":
+		candidates, start, end = findClassCandidates(scope, content, errorInfo)
+		if start == -1 {
+			return nil
+		}
+
+		name = strings.Split(content, "\n")[errorInfo.Line][start:end]
+
+	default:
+		return nil
+	}
+
+	suggestions := findClosestNames(name, candidates)
+	if len(suggestions) == 0 {
+		return nil
+	}
+
+	line := strings.Split(content, "\n")[errorInfo.Line]
+
+	return &DidYouMeanData{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: errorInfo.Line, Character: offsetToPosition(line, start).Character},
+			End:   protocol.Position{Line: errorInfo.Line, Character: offsetToPosition(line, end).Character},
+		},
+		Suggestions: suggestions,
+	}
+}
+
+// addDidYouMeanData stores the suggestions for each undefined method or
+// class in the data of its diagnostic
+func addDidYouMeanData(scope *workspaceScope, content string, diagnostics []protocol.Diagnostic) []protocol.Diagnostic {
+	if !getSettings(scope).Features.CodeActions {
+		return diagnostics
+	}
+
+	for i, diagnostic := range diagnostics {
+		errorInfo := parseErrorMessage(diagnostic.Message, diagnostic.Range.Start.Line)
+		if errorInfo == nil {
+			continue
+		}
+
+		if data := findDidYouMean(scope, content, errorInfo); data != nil {
+			diagnostics[i].Data = data
+		}
+	}
+
+	return diagnostics
+}
+
+func decodeDidYouMeanData(value any) (DidYouMeanData, error) {
+	var data DidYouMeanData
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return data, err
+	}
+
+	err = json.Unmarshal(raw, &data)
+
+	return data, err
+}
+
+// createDidYouMeanCodeActions replaces a misspelled method or class with
+// the closest known names found when the diagnostic was published
+func createDidYouMeanCodeActions(uri protocol.DocumentUri, diagnostic protocol.Diagnostic) []protocol.CodeAction {
+	if diagnostic.Data == nil {
+		return nil
+	}
+
+	data, err := decodeDidYouMeanData(diagnostic.Data)
+	if err != nil {
+		return nil
+	}
+
+	var codeActions []protocol.CodeAction
+
+	kind := protocol.CodeActionKindQuickFix
+
+	for i, suggestion := range data.Suggestions {
+		changes := make(map[protocol.DocumentUri][]protocol.TextEdit)
+
+		changes[uri] = []protocol.TextEdit{
+			{
+				Range:   data.Range,
+				NewText: suggestion,
+			},
+		}
+
+		codeActions = append(codeActions, protocol.CodeAction{
+			Title:       fmt.Sprintf("Did you mean '%s'?", suggestion),
+			Kind:        &kind,
+			Diagnostics: []protocol.Diagnostic{diagnostic},
+			IsPreferred: &[]bool{i == 0}[0],
+			Edit:        &protocol.WorkspaceEdit{Changes: changes},
+		})
+	}
+
+	return codeActions
+}
@@ -0,0 +1,97 @@
+package lsp
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestLevenshteinDistance(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		distance int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"abc", "abc", 0},
+		{"kitten", "sitting", 3},
+		{"lenght", "length", 2},
+		{"to_s", "to_sym", 2},
+		{"Foo::Ba", "Foo::Bar", 1},
+		{"Fo::Bar", "A::B", 4},
+	}
+
+	for _, test := range tests {
+		if got := levenshteinDistance(test.a, test.b); got != test.distance {
+			t.Errorf("levenshteinDistance(%q, %q) = %d, want %d", test.a, test.b, got, test.distance)
+		}
+
+		if got := levenshteinDistance(test.b, test.a); got != test.distance {
+			t.Errorf("levenshteinDistance(%q, %q) = %d, want %d", test.b, test.a, got, test.distance)
+		}
+	}
+}
+
+func TestFindClosestNames(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []string
+		want       []string
+	}{
+		{"lenght", []string{"length", "size", "lengths"}, []string{"length", "lengths"}},
+		{"to_s", []string{"to_s", "to_sym", "to_a", "to_h", "to_i"}, []string{"to_a", "to_h", "to_i"}},
+		{"Strng", []string{"string", "Symbol"}, []string{"string"}},
+		{"Foo::Ba", []string{"Foo::Bar", "Ba", "A::B"}, []string{"Foo::Bar"}},
+		{"xyz", []string{"length"}, nil},
+	}
+
+	for _, test := range tests {
+		if got := findClosestNames(test.name, test.candidates); !slices.Equal(got, test.want) {
+			t.Errorf("findClosestNames(%q) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDidYouMeanData(t *testing.T) {
+	scope := &workspaceScope{Root: t.TempDir()}
+	uri := protocol.DocumentUri("file://" + scope.Root + "/test.rb")
+
+	content := "def greet\nend\n\nx = 'é'; greeet\n"
+
+	diagnostics := addDidYouMeanData(scope, content, []protocol.Diagnostic{
+		{
+			Range:   protocol.Range{Start: protocol.Position{Line: 3}, End: protocol.Position{Line: 3}},
+			Message: "instance method 'greeet' is not defined for Object",
+		},
+	})
+
+	// the client sends the diagnostic back with its data as plain JSON
+	raw, err := json.Marshal(diagnostics[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var diagnostic protocol.Diagnostic
+	if err := json.Unmarshal(raw, &diagnostic); err != nil {
+		t.Fatal(err)
+	}
+
+	codeActions := createDidYouMeanCodeActions(uri, diagnostic)
+	if len(codeActions) != 1 {
+		t.Fatalf("got %d code actions, want 1", len(codeActions))
+	}
+
+	edit := codeActions[0].Edit.Changes[uri][0]
+	if edit.NewText != "greet" {
+		t.Errorf("suggestion = %q, want %q", edit.NewText, "greet")
+	}
+
+	want := protocol.Range{Start: protocol.Position{Line: 3, Character: 9}, End: protocol.Position{Line: 3, Character: 15}}
+	if edit.Range != want {
+		t.Errorf("range = %+v, want %+v", edit.Range, want)
+	}
+}
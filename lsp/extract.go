@@ -0,0 +1,401 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+var localReferencePattern = regexp.MustCompile(`(?:^|[^.@:$\w])([a-z_]\w*)\b[?!]?`)
+
+// uniqueLocalName returns base, or base2, base3... when base is taken
+func uniqueLocalName(base string, taken []string) string {
+	name := base
+	for i := 2; slices.Contains(taken, name); i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+
+	return name
+}
+
+// findLocalReferences lists identifiers in code that look like locals
+func findLocalReferences(code string) []string {
+	var names []string
+
+	for _, matches := range localReferencePattern.FindAllStringSubmatch(stripRubyLine(code), -1) {
+		if strings.HasSuffix(matches[0], "?") || strings.HasSuffix(matches[0], "!") {
+			continue
+		}
+
+		if slices.Contains(rubyKeywords, matches[1]) {
+			continue
+		}
+
+		names = appendUnique(names, matches[1])
+	}
+
+	return names
+}
+
+// findLocalAssignments lists locals assigned in code
+func findLocalAssignments(code string) []string {
+	var names []string
+
+	stripped := stripRubyLine(code)
+
+	if matches := multiAssignPattern.FindStringSubmatch(stripped); matches != nil {
+		for _, name := range strings.Split(matches[1], ",") {
+			names = appendUnique(names, strings.TrimPrefix(strings.TrimSpace(name), "*"))
+		}
+	}
+
+	for _, matches := range localAssignPattern.FindAllStringSubmatch(stripped, -1) {
+		names = appendUnique(names, matches[1])
+	}
+
+	return names
+}
+
+// findEnclosingDef returns the def line around [startLine, endLine] and
+// the line of its end, or -1, -1 at top level
+func findEnclosingDef(lines []string, startLine int, endLine int) (int, int) {
+	for i := startLine; i >= 0; i-- {
+		trimmed := strings.TrimSpace(stripRubyLine(lines[i]))
+		if !defPattern.MatchString(trimmed) || endlessDefPattern.MatchString(trimmed) {
+			continue
+		}
+
+		defEnd := findScopeEnd(lines, i)
+		if defEnd == -1 || defEnd <= endLine || i == startLine {
+			continue
+		}
+
+		return i, defEnd
+	}
+
+	return -1, -1
+}
+
+// isBalancedSelection tells whether body closes every block it opens and
+// none that was opened before it
+func isBalancedSelection(body []string) bool {
+	// scanRubyStatement never pops the last scope, the guard below it shows
+	// an `end` without its opening line
+	stack := []*rubyScope{{Kind: "top"}, {Kind: "top"}}
+
+	var constants []RubyConstant
+
+	for _, text := range body {
+		code := strings.TrimSpace(stripRubyLine(text))
+
+		for statement := range strings.SplitSeq(code, ";") {
+			stack = scanRubyStatement(stack, strings.TrimSpace(statement), &constants)
+			if len(stack) < 2 {
+				return false
+			}
+		}
+	}
+
+	return len(stack) == 2
+}
+
+// inferDefinedSignature asks ti for the signature of the def on row
+func inferDefinedSignature(scope *workspaceScope, content string, row int) string {
+	infos, err := getDefineInfos(scope, content)
+	if err != nil {
+		return ""
+	}
+
+	for _, info := range infos {
+		if info.Row == row+1 {
+			return info.Signature
+		}
+	}
+
+	return ""
+}
+
+func makeRefactorEdit(uri protocol.DocumentUri, edits []protocol.TextEdit) *protocol.WorkspaceEdit {
+	changes := make(map[protocol.DocumentUri][]protocol.TextEdit)
+	changes[uri] = edits
+
+	return &protocol.WorkspaceEdit{Changes: changes}
+}
+
+// createExtractVariableCodeAction moves the selected expression into a
+// local assigned on the line above
+func createExtractVariableCodeAction(
+	uri protocol.DocumentUri,
+	content string,
+	selection protocol.Range,
+) *protocol.CodeAction {
+
+	if selection.Start.Line != selection.End.Line {
+		return nil
+	}
+
+	lines := strings.Split(content, "\n")
+	if int(selection.Start.Line) >= len(lines) {
+		return nil
+	}
+
+	line := lines[selection.Start.Line]
+	if int(selection.End.Character) > len(line) || selection.Start.Character >= selection.End.Character {
+		return nil
+	}
+
+	expr := strings.TrimSpace(line[selection.Start.Character:selection.End.Character])
+	if expr == "" || expr == strings.TrimSpace(line) {
+		return nil
+	}
+
+	// a whole statement is not an expression worth naming
+	if len(splitTopLevel(expr, ';')) != 1 || scopeKeywordPattern.MatchString(stripRubyLine(expr)) {
+		return nil
+	}
+
+	info := findScopeInfo(content, selection.Start.Line, selection.Start.Character)
+
+	taken := slices.Concat(info.Locals, info.Params, info.BlockParams, info.Methods)
+	name := uniqueLocalName("extracted", taken)
+
+	indent := lineIndent(line, 0)
+
+	kind := protocol.CodeActionKindRefactorExtract
+
+	return &protocol.CodeAction{
+		Title: "Extract to local variable",
+		Kind:  &kind,
+		Edit: makeRefactorEdit(uri, []protocol.TextEdit{
+			{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: selection.Start.Line, Character: 0},
+					End:   protocol.Position{Line: selection.Start.Line, Character: 0},
+				},
+				NewText: fmt.Sprintf("%s%s = %s\n", indent, name, expr),
+			},
+			{
+				Range:   selection,
+				NewText: name,
+			},
+		}),
+	}
+}
+
+// createExtractMethodCodeAction moves the selected lines into a new method,
+// passing the locals they read and returning the locals read afterwards
+func createExtractMethodCodeAction(
+	scope *workspaceScope,
+	uri protocol.DocumentUri,
+	content string,
+	selection protocol.Range,
+) *protocol.CodeAction {
+
+	lines := strings.Split(content, "\n")
+
+	startLine := int(selection.Start.Line)
+	endLine := int(selection.End.Line)
+
+	// a selection ending at column 0 does not include that line
+	if endLine > startLine && selection.End.Character == 0 {
+		endLine--
+	}
+
+	if endLine >= len(lines) {
+		return nil
+	}
+
+	// a part of a single line is an expression, not statements
+	if selection.Start.Line == selection.End.Line {
+		line := lines[startLine]
+		if int(selection.End.Character) > len(line) ||
+			strings.TrimSpace(line[selection.Start.Character:selection.End.Character]) != strings.TrimSpace(line) {
+
+			return nil
+		}
+	}
+
+	body := lines[startLine : endLine+1]
+
+	if strings.TrimSpace(strings.Join(body, "")) == "" {
+		return nil
+	}
+
+	// the selection must not open or close scopes of its own
+	if !isBalancedSelection(body) {
+		return nil
+	}
+
+	info := findScopeInfo(content, uint32(startLine), 0)
+	visible := slices.Concat(info.Locals, info.Params, info.BlockParams)
+
+	var params []string
+	var assigned []string
+
+	for _, text := range body {
+		for _, name := range findLocalReferences(text) {
+			if slices.Contains(visible, name) && !slices.Contains(assigned, name) {
+				params = appendUnique(params, name)
+			}
+		}
+
+		assigned = appendUnique(assigned, findLocalAssignments(text)...)
+	}
+
+	defLine, defEnd := findEnclosingDef(lines, startLine, endLine)
+
+	// locals assigned in the selection and read after it come back out
+	var results []string
+
+	afterEnd := len(lines)
+	if defEnd != -1 {
+		afterEnd = defEnd
+	}
+
+	for _, text := range lines[endLine+1 : afterEnd] {
+		for _, name := range findLocalReferences(text) {
+			if slices.Contains(assigned, name) {
+				results = appendUnique(results, name)
+			}
+		}
+	}
+
+	taken := slices.Concat(visible, info.Methods, assigned)
+	methodName := uniqueLocalName("extracted", taken)
+
+	signature := methodName
+	if len(params) > 0 {
+		signature += "(" + strings.Join(params, ", ") + ")"
+	}
+
+	bodyIndent := lineIndent(lines[startLine], 0)
+
+	call := signature
+	switch len(results) {
+	case 0:
+	case 1:
+		call = results[0] + " = " + signature
+	default:
+		call = strings.Join(results, ", ") + " = " + signature
+	}
+
+	defIndent := bodyIndent
+	insertLine := startLine
+	if defLine != -1 {
+		defIndent = lineIndent(lines[defLine], 0)
+		insertLine = defEnd + 1
+	}
+
+	var method strings.Builder
+
+	fmt.Fprintf(&method, "%sdef %s\n", defIndent, signature)
+
+	for _, text := range body {
+		if strings.TrimSpace(text) == "" {
+			method.WriteString("\n")
+			continue
+		}
+
+		fmt.Fprintf(&method, "%s  %s\n", defIndent, strings.TrimPrefix(text, bodyIndent))
+	}
+
+	switch len(results) {
+	case 0:
+	case 1:
+		fmt.Fprintf(&method, "%s  %s\n", defIndent, results[0])
+	default:
+		fmt.Fprintf(&method, "%s  [%s]\n", defIndent, strings.Join(results, ", "))
+	}
+
+	fmt.Fprintf(&method, "%send\n", defIndent)
+
+	methodText := method.String()
+	if defLine != -1 {
+		methodText = "\n" + methodText
+	} else {
+		methodText += "\n"
+	}
+
+	callText := bodyIndent + call + "\n"
+
+	// ask ti what the new method looks like in the rewritten document
+	var rewritten []string
+	var methodRow int
+
+	if defLine != -1 {
+		rewritten = slices.Concat(lines[:startLine], []string{strings.TrimSuffix(callText, "\n")}, lines[endLine+1:insertLine])
+		methodRow = len(rewritten) + 1
+		rewritten = slices.Concat(rewritten, strings.Split(strings.TrimSuffix(methodText, "\n"), "\n"), lines[insertLine:])
+	} else {
+		methodRow = startLine
+		rewritten = slices.Concat(lines[:startLine], strings.Split(strings.TrimSuffix(methodText, "\n"), "\n"), []string{strings.TrimSuffix(callText, "\n")}, lines[endLine+1:])
+	}
+
+	if inferred := inferDefinedSignature(scope, strings.Join(rewritten, "\n"), methodRow); inferred != "" {
+		methodText = strings.Replace(
+			methodText,
+			defIndent+"def ",
+			fmt.Sprintf("%s# %s\n%sdef ", defIndent, inferred, defIndent),
+			1,
+		)
+	}
+
+	edits := []protocol.TextEdit{
+		{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: uint32(startLine), Character: 0},
+				End:   protocol.Position{Line: uint32(endLine + 1), Character: 0},
+			},
+			NewText: callText,
+		},
+	}
+
+	methodEdit := protocol.TextEdit{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: uint32(insertLine), Character: 0},
+			End:   protocol.Position{Line: uint32(insertLine), Character: 0},
+		},
+		NewText: methodText,
+	}
+
+	if defLine != -1 {
+		edits = append(edits, methodEdit)
+	} else {
+		edits = append([]protocol.TextEdit{methodEdit}, edits...)
+	}
+
+	kind := protocol.CodeActionKindRefactorExtract
+
+	return &protocol.CodeAction{
+		Title: "Extract to method",
+		Kind:  &kind,
+		Edit:  makeRefactorEdit(uri, edits),
+	}
+}
+
+// createExtractCodeActions offers refactor.extract actions for a selection
+func createExtractCodeActions(scope *workspaceScope, uri protocol.DocumentUri, selection protocol.Range) []protocol.CodeAction {
+	if selection.Start == selection.End || isJsonFile(uri) {
+		return nil
+	}
+
+	content := getDocumentContent(uri)
+	if content == "" {
+		return nil
+	}
+
+	var codeActions []protocol.CodeAction
+
+	if action := createExtractVariableCodeAction(uri, content, selection); action != nil {
+		codeActions = append(codeActions, *action)
+	}
+
+	if action := createExtractMethodCodeAction(scope, uri, content, selection); action != nil {
+		codeActions = append(codeActions, *action)
+	}
+
+	return codeActions
+}
@@ -0,0 +1,520 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const codeActionKindGenerateConfig = protocol.CodeActionKind("source.generateTiConfig")
+
+var (
+	superclassPattern = regexp.MustCompile(`^class\s+[A-Z][\w:]*\s*<\s*([A-Z][\w:]*)`)
+
+	includePattern = regexp.MustCompile(`^(?:include|extend|prepend)\s+([A-Z][\w:]*)`)
+
+	classConstantPattern = regexp.MustCompile(`^([A-Z]\w*)\s*=\s*([^=~>].*)$`)
+
+	signatureNamePattern = regexp.MustCompile(`^def\s+(self\.)?([^\s({]+)`)
+)
+
+// RubyMethodDefinition is a def found directly in a class body
+type RubyMethodDefinition struct {
+	Name          string
+	Params        string
+	Line          int
+	IsClassMethod bool
+}
+
+// RubyConstantDefinition is a constant assigned directly in a class body
+type RubyConstantDefinition struct {
+	Name  string
+	Value string
+	Line  int
+}
+
+// RubyClassDefinition is a class or module body in a ruby document
+type RubyClassDefinition struct {
+	Name      string
+	IsModule  bool
+	Line      int
+	EndLine   int
+	Extends   []string
+	Methods   []RubyMethodDefinition
+	Constants []RubyConstantDefinition
+}
+
+// findRubyClassDefinitions lists the classes in content with the methods
+// and constants written directly in their bodies
+func findRubyClassDefinitions(content string) []*RubyClassDefinition {
+	lines := strings.Split(content, "\n")
+
+	stack := []*rubyScope{{Kind: "top"}}
+	owners := make(map[*rubyScope]*RubyClassDefinition)
+
+	var definitions []*RubyClassDefinition
+	var constants []RubyConstant
+
+	for i, line := range lines {
+		code := strings.TrimSpace(stripRubyLine(line))
+		depth := len(stack)
+		current := stack[depth-1]
+
+		owner := owners[innermostClass(stack)]
+		isDirect := owner != nil && (owners[current] == owner || current.Kind == "sclass" && owners[stack[depth-2]] == owner)
+
+		if isDirect {
+			switch {
+			case strings.HasPrefix(code, "def "):
+				if matches := defPattern.FindStringSubmatch(code); matches != nil {
+					params := matches[4]
+					if params == "" {
+						params = matches[5]
+					}
+
+					owner.Methods = append(owner.Methods, RubyMethodDefinition{
+						Name:          matches[2],
+						Params:        strings.TrimSpace(params),
+						Line:          i,
+						IsClassMethod: matches[1] != "" || current.Kind == "sclass",
+					})
+				}
+
+			case includePattern.MatchString(code):
+				matches := includePattern.FindStringSubmatch(code)
+				owner.Extends = appendUnique(owner.Extends, matches[1])
+
+			case classConstantPattern.MatchString(code):
+				matches := classConstantPattern.FindStringSubmatch(code)
+				owner.Constants = append(owner.Constants, RubyConstantDefinition{
+					Name:  matches[1],
+					Value: strings.TrimSpace(matches[2]),
+					Line:  i,
+				})
+			}
+		}
+
+		stack = scanRubyLine(stack, line, &constants)
+
+		if len(stack) > depth {
+			scope := stack[depth]
+			if (scope.Kind == "class" || scope.Kind == "module") && owners[scope] == nil {
+				definition := &RubyClassDefinition{
+					Name:     currentNamespace(stack[:depth+1]),
+					IsModule: scope.Kind == "module",
+					Line:     i,
+					EndLine:  findScopeEnd(lines, i),
+				}
+
+				if matches := superclassPattern.FindStringSubmatch(code); matches != nil {
+					definition.Extends = append(definition.Extends, matches[1])
+				}
+
+				owners[scope] = definition
+				definitions = append(definitions, definition)
+			}
+		}
+	}
+
+	return definitions
+}
+
+// splitTypeUnion splits `Int | String` into its types
+func splitTypeUnion(types string) []string {
+	var names []string
+
+	for _, name := range strings.Split(types, "|") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// parseTiMethodSignature reads a signature in the formatTiMethodSignature
+// notation back into a TiMethod
+func parseTiMethodSignature(signature string) (*TiMethod, bool) {
+	matches := signatureNamePattern.FindStringSubmatch(signature)
+	if matches == nil {
+		return nil, false
+	}
+
+	method := &TiMethod{
+		Name:      matches[2],
+		Arguments: []TiArgument{},
+	}
+
+	rest := strings.TrimSpace(signature[len(matches[0]):])
+
+	if strings.HasPrefix(rest, "(") {
+		end := strings.Index(rest, ")")
+		if end == -1 {
+			return nil, false
+		}
+
+		for _, argument := range splitTopLevel(rest[1:end], ',') {
+			switch {
+			case strings.HasPrefix(argument, "*"):
+				method.Arguments = append(method.Arguments, TiArgument{
+					Type:       splitTypeUnion(strings.TrimPrefix(argument, "*")),
+					IsAsterisk: true,
+				})
+
+			case keywordArgumentPattern.MatchString(argument):
+				keyword := keywordArgumentPattern.FindStringSubmatch(argument)
+				method.Arguments = append(method.Arguments, TiArgument{
+					Type: splitTypeUnion(keyword[2]),
+					Key:  keyword[1],
+				})
+
+			default:
+				method.Arguments = append(method.Arguments, TiArgument{
+					Type: splitTypeUnion(argument),
+				})
+			}
+		}
+
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+
+	if strings.HasPrefix(rest, "{") {
+		end := strings.Index(rest, "}")
+		if end == -1 {
+			return nil, false
+		}
+
+		block := strings.Trim(strings.TrimSpace(rest[1:end]), "|")
+
+		method.BlockParameters = []string{}
+		for _, parameter := range splitTopLevel(block, ',') {
+			method.BlockParameters = append(method.BlockParameters, parameter)
+		}
+
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+
+	returnTypes, ok := strings.CutPrefix(rest, "->")
+	if !ok {
+		return nil, false
+	}
+
+	types := splitTypeUnion(returnTypes)
+	if len(types) > 1 && slices.Contains(types, "NilClass") {
+		types = slices.DeleteFunc(types, func(name string) bool { return name == "NilClass" })
+		method.ReturnType.IsConditional = true
+	}
+
+	method.ReturnType.Type = types
+
+	return method, len(types) > 0
+}
+
+// makeUntypedMethod builds a TiMethod from the parameter list alone
+func makeUntypedMethod(name string, params string) TiMethod {
+	method := TiMethod{
+		Name:      name,
+		Arguments: []TiArgument{},
+		ReturnType: TiReturnType{
+			Type: []string{"Untyped"},
+		},
+	}
+
+	for _, param := range splitTopLevel(strings.Trim(params, "()"), ',') {
+		switch {
+		case strings.HasPrefix(param, "&"):
+			method.BlockParameters = []string{}
+
+		case strings.HasPrefix(param, "**"):
+			method.Arguments = append(method.Arguments, TiArgument{Type: []string{"Hash"}})
+
+		case strings.HasPrefix(param, "*"):
+			method.Arguments = append(method.Arguments, TiArgument{
+				Type:       []string{"Untyped"},
+				IsAsterisk: true,
+			})
+
+		case strings.Contains(param, ":"):
+			key, value, _ := strings.Cut(param, ":")
+
+			typeName := "Untyped"
+			if value = strings.TrimSpace(value); value != "" {
+				if literalType := inferLiteralType(value); literalType != "" {
+					typeName = literalType
+				}
+			}
+
+			method.Arguments = append(method.Arguments, TiArgument{
+				Type: []string{typeName},
+				Key:  strings.TrimSpace(key),
+			})
+
+		default:
+			typeName := "Untyped"
+			if _, value, ok := strings.Cut(param, "="); ok {
+				typeName = "Default" + typeName
+				if literalType := inferLiteralType(strings.TrimSpace(value)); literalType != "" {
+					typeName = "Default" + literalType
+				}
+			}
+
+			method.Arguments = append(method.Arguments, TiArgument{Type: []string{typeName}})
+		}
+	}
+
+	return method
+}
+
+// makeClassConfig infers a TiClassConfig for definition, asking ti for the
+// signature of each method
+func makeClassConfig(scope *workspaceScope, content string, definition *RubyClassDefinition) TiClassConfig {
+	classConfig := TiClassConfig{
+		Frame:           "Builtin",
+		Class:           definition.Name,
+		Extends:         slices.Clone(definition.Extends),
+		InstanceMethods: []TiMethod{},
+		ClassMethods:    []TiMethod{},
+		Constants:       []TiConstantType{},
+	}
+
+	if classConfig.Extends == nil {
+		classConfig.Extends = []string{}
+	}
+
+	signatures := make(map[int]string)
+	if infos, err := getDefineInfos(scope, content); err == nil {
+		for _, info := range infos {
+			signatures[info.Row-1] = info.Signature
+		}
+	}
+
+	for _, definedMethod := range definition.Methods {
+		method := makeUntypedMethod(definedMethod.Name, definedMethod.Params)
+
+		if inferred, ok := parseTiMethodSignature(signatures[definedMethod.Line]); ok {
+			inferred.Name = definedMethod.Name
+			method = *inferred
+		}
+
+		switch {
+		case definedMethod.Name == "initialize" && !definedMethod.IsClassMethod:
+			// ti models construction as the class method new
+			method.Name = "new"
+			method.ReturnType = TiReturnType{Type: []string{definition.Name}}
+			classConfig.ClassMethods = append(classConfig.ClassMethods, method)
+
+		case definedMethod.IsClassMethod:
+			classConfig.ClassMethods = append(classConfig.ClassMethods, method)
+
+		default:
+			classConfig.InstanceMethods = append(classConfig.InstanceMethods, method)
+		}
+	}
+
+	for _, constant := range definition.Constants {
+		classConfig.Constants = append(classConfig.Constants, TiConstantType{
+			Name: constant.Name,
+			ReturnType: TiReturnType{
+				Type: []string{inferExpressionType(scope, content, uint32(constant.Line), constant.Value)},
+			},
+		})
+	}
+
+	return classConfig
+}
+
+// applyTextEdit returns content with edit applied
+func applyTextEdit(content string, edit protocol.TextEdit) string {
+	start := positionToOffset(content, edit.Range.Start)
+	end := positionToOffset(content, edit.Range.End)
+
+	return content[:start] + edit.NewText + content[end:]
+}
+
+// mergeClassConfig adds what generated has and content lacks, leaving the
+// entries already in content as they were written
+func mergeClassConfig(content string, generated TiClassConfig) (string, bool) {
+	var existing TiClassConfig
+	if err := json.Unmarshal([]byte(content), &existing); err != nil {
+		return "", false
+	}
+
+	merged := content
+
+	appendItem := func(section string, value any) bool {
+		edit := makeAppendToArrayEdit(merged, section, value)
+		if edit == nil {
+			return false
+		}
+
+		merged = applyTextEdit(merged, *edit)
+
+		return true
+	}
+
+	for _, parentClass := range generated.Extends {
+		if !slices.Contains(existing.Extends, parentClass) && !appendItem("extends", parentClass) {
+			return "", false
+		}
+	}
+
+	hasMethod := func(methods []TiMethod, name string) bool {
+		return slices.ContainsFunc(methods, func(method TiMethod) bool { return method.Name == name })
+	}
+
+	for _, method := range generated.InstanceMethods {
+		if !hasMethod(existing.InstanceMethods, method.Name) && !appendItem("instance_methods", method) {
+			return "", false
+		}
+	}
+
+	for _, method := range generated.ClassMethods {
+		if !hasMethod(existing.ClassMethods, method.Name) && !appendItem("class_methods", method) {
+			return "", false
+		}
+	}
+
+	for _, constant := range generated.Constants {
+		hasConstant := slices.ContainsFunc(existing.Constants, func(existingConstant TiConstantType) bool {
+			return existingConstant.Name == constant.Name
+		})
+
+		if !hasConstant && !appendItem("constants", constant) {
+			return "", false
+		}
+	}
+
+	return merged, true
+}
+
+// makeGenerateConfigEdit writes the generated config for definition into
+// .ti-config, merging into an existing class file
+func makeGenerateConfigEdit(scope *workspaceScope, content string, definition *RubyClassDefinition) *protocol.WorkspaceEdit {
+	return makeClassConfigEdit(scope, makeClassConfig(scope, content, definition))
+}
+
+// makeClassConfigEdit creates the class file for classConfig in .ti-config,
+// or merges it into the one already there. It returns nil when a new file
+// is needed and the client cannot create files
+func makeClassConfigEdit(scope *workspaceScope, classConfig TiClassConfig) *protocol.WorkspaceEdit {
+	configDir := findBuiltinConfigDir(scope)
+	if configDir == "" {
+		return nil
+	}
+
+	filePath := filepath.Join(configDir, strings.ToLower(classConfig.Class)+".json")
+	fileUri := protocol.DocumentUri("file://" + filePath)
+
+	changes := make(map[protocol.DocumentUri][]protocol.TextEdit)
+
+	if _, err := os.Stat(filePath); err == nil {
+		existing := readWorkspaceFile(filePath)
+
+		merged, ok := mergeClassConfig(existing, classConfig)
+		if !ok || merged == existing {
+			return nil
+		}
+
+		changes[fileUri] = []protocol.TextEdit{
+			{
+				Range:   makeOffsetRange(existing, 0, len(existing)),
+				NewText: merged,
+			},
+		}
+
+		return &protocol.WorkspaceEdit{Changes: changes}
+	}
+
+	if !supportsCreateFile {
+		return nil
+	}
+
+	jsonData, err := json.MarshalIndent(classConfig, "", "  ")
+	if err != nil {
+		return nil
+	}
+
+	return &protocol.WorkspaceEdit{
+		DocumentChanges: []any{
+			protocol.CreateFile{
+				Kind: "create",
+				URI:  fileUri,
+			},
+			protocol.TextDocumentEdit{
+				TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+					TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: fileUri},
+				},
+				Edits: []any{
+					protocol.TextEdit{
+						Range: protocol.Range{
+							Start: protocol.Position{Line: 0, Character: 0},
+							End:   protocol.Position{Line: 0, Character: 0},
+						},
+						NewText: string(jsonData) + "\n",
+					},
+				},
+			},
+		},
+	}
+}
+
+// findTargetClassDefinitions returns the innermost class around line, or
+// every class in the document when line is outside of them
+func findTargetClassDefinitions(content string, line uint32) []*RubyClassDefinition {
+	definitions := findRubyClassDefinitions(content)
+
+	var innermost *RubyClassDefinition
+
+	for _, definition := range definitions {
+		if int(line) >= definition.Line && int(line) <= definition.EndLine {
+			innermost = definition
+		}
+	}
+
+	if innermost != nil {
+		return []*RubyClassDefinition{innermost}
+	}
+
+	return definitions
+}
+
+// createGenerateConfigCodeActions offers writing .ti-config JSON for the
+// ruby classes at the cursor
+func createGenerateConfigCodeActions(uri protocol.DocumentUri, selection protocol.Range) []protocol.CodeAction {
+	if isJsonFile(uri) {
+		return nil
+	}
+
+	content := getDocumentContent(uri)
+	if content == "" {
+		return nil
+	}
+
+	var codeActions []protocol.CodeAction
+
+	kind := codeActionKindGenerateConfig
+
+	for _, definition := range findTargetClassDefinitions(content, selection.Start.Line) {
+		if len(definition.Methods) == 0 && len(definition.Constants) == 0 {
+			continue
+		}
+
+		codeActions = append(codeActions, protocol.CodeAction{
+			Title: fmt.Sprintf("Generate .ti-config for '%s'", definition.Name),
+			Kind:  &kind,
+			Command: &protocol.Command{
+				Title:     fmt.Sprintf("Generate .ti-config for '%s'", definition.Name),
+				Command:   "ruby-ti.generateConfig",
+				Arguments: []any{uri, definition.Name},
+			},
+		})
+	}
+
+	return codeActions
+}
@@ -0,0 +1,33 @@
+package lsp
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestMakeUntypedMethodBlockParameters(t *testing.T) {
+	tests := []struct {
+		params string
+		want   []string
+	}{
+		{"(a, b)", nil},
+		{"(a, &block)", []string{}},
+	}
+
+	for _, test := range tests {
+		data, err := json.Marshal(makeUntypedMethod("foo", test.params))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var method TiMethod
+		if err := json.Unmarshal(data, &method); err != nil {
+			t.Fatal(err)
+		}
+
+		if (method.BlockParameters == nil) != (test.want == nil) || !slices.Equal(method.BlockParameters, test.want) {
+			t.Errorf("makeUntypedMethod(%q) block parameters after JSON = %#v, want %#v", test.params, method.BlockParameters, test.want)
+		}
+	}
+}
@@ -1,17 +1,16 @@
 package lsp
 
 import (
-	"context"
+	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
-	"time"
 
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
 func findHover(
+	scope *workspaceScope,
 	content string,
 	params *protocol.HoverParams,
 ) (*protocol.Hover, error) {
@@ -30,7 +29,7 @@ func findHover(
 
 	tmpFile.Close()
 
-	hoverInfo := getTiOutForHover(tmpFile.Name(), int(params.Position.Line)+1)
+	hoverInfo := getTiOutForHover(scope, tmpFile.Name(), int(params.Position.Line)+1)
 
 	if hoverInfo == "" {
 		return nil, nil
@@ -46,22 +45,21 @@ func findHover(
 	return hover, nil
 }
 
-func getTiOutForHover(filename string, row int) string {
-	ctx, cancel :=
-		context.WithTimeout(context.Background(), 1000*time.Millisecond)
+func getTiOutForHover(scope *workspaceScope, filename string, row int) string {
+	ctx, cancel := tiTimeoutContext(scope)
 
 	defer cancel()
 
 	cmd :=
-		exec.CommandContext(
+		tiCommand(
+			scope,
 			ctx,
-			"ti",
 			filename,
 			"--hover",
 			fmt.Sprintf("--row=%d", row),
 		)
 
-	output, err := cmd.Output()
+	output, err := runTi(ctx, cmd)
 	if err != nil {
 		return ""
 	}
@@ -113,3 +111,123 @@ func parseHoverOutput(cmdOutput []byte) string {
 
 	return strings.TrimSpace(markdownBuilder.String())
 }
+
+func makeClassSummary(scope *workspaceScope, className string) string {
+	for _, classConfig := range loadClassConfigs(scope) {
+		if classConfig.Class != className {
+			continue
+		}
+
+		var markdownBuilder strings.Builder
+
+		markdownBuilder.WriteString("```ruby\nclass " + classConfig.Class)
+		if len(classConfig.Extends) > 0 {
+			markdownBuilder.WriteString(" < " + strings.Join(classConfig.Extends, ", "))
+		}
+		markdownBuilder.WriteString("\n```\n\n")
+
+		markdownBuilder.WriteString(fmt.Sprintf(
+			"frame: `%s`, %d instance methods, %d class methods, %d constants",
+			classConfig.Frame,
+			len(classConfig.InstanceMethods),
+			len(classConfig.ClassMethods),
+			len(classConfig.Constants),
+		))
+
+		return markdownBuilder.String()
+	}
+
+	return ""
+}
+
+func makeTypeHover(scope *workspaceScope, typeName string) string {
+	documentation := makeTypeDocumentation(typeName)
+	if documentation == "" {
+		return makeClassSummary(scope, typeName)
+	}
+
+	return "**" + typeName + "**: " + makeTypeDetail(typeName) + "\n\n" + documentation
+}
+
+func makeJsonObjectHover(content string, node *JsonNode, schema string) string {
+	switch schema {
+	case "method":
+		var method TiMethod
+		if err := json.Unmarshal([]byte(content[node.Start:node.End]), &method); err != nil {
+			return ""
+		}
+
+		isClassMethod := false
+		if member := node.ParentMember(); member != nil {
+			isClassMethod = member.Key == "class_methods"
+		}
+
+		hover := "```ruby\n" + formatTiMethodSignature(method, isClassMethod) + "\n```"
+		if method.Document != "" {
+			hover += "\n\n---\n\n" + method.Document
+		}
+
+		return hover
+
+	case "constant":
+		var constant TiConstantType
+		if err := json.Unmarshal([]byte(content[node.Start:node.End]), &constant); err != nil {
+			return ""
+		}
+
+		return "```ruby\n" + constant.Name + ": " +
+			strings.Join(constant.ReturnType.Type, " | ") + "\n```"
+	}
+
+	return ""
+}
+
+// findJsonHover explains type names, methods and extends in .ti-config
+func findJsonHover(
+	scope *workspaceScope,
+	content string,
+	params *protocol.HoverParams,
+) (*protocol.Hover, error) {
+
+	root, _ := parseJsonNode(content)
+	offset := positionToOffset(content, params.Position)
+
+	cursor := findJsonCursor(root, content, offset)
+	if cursor == nil {
+		return nil, nil
+	}
+
+	var field ConfigField
+	if cursor.Member != nil {
+		field = configSchemas[cursor.Schema][cursor.Member.Key]
+	}
+
+	var hoverInfo string
+
+	switch {
+	case cursor.InKey:
+		hoverInfo = fmt.Sprintf("**%s**: %s\n\n%s", cursor.Member.Key, field.Kind, field.Description)
+
+	case cursor.Node != nil && cursor.Node.Kind == JsonString && field.IsTypeName:
+		hoverInfo = makeTypeHover(scope, cursor.Node.Value)
+
+	case cursor.Node != nil && cursor.Node.Kind == JsonString && field.IsClassName:
+		hoverInfo = makeClassSummary(scope, cursor.Node.Value)
+	}
+
+	// anywhere else inside a method or constant entry shows its signature
+	for node := cursor.Object; hoverInfo == "" && node != nil; node = node.EnclosingObject() {
+		hoverInfo = makeJsonObjectHover(content, node, findJsonSchema(node))
+	}
+
+	if hoverInfo == "" {
+		return nil, nil
+	}
+
+	return &protocol.Hover{
+		Contents: protocol.MarkupContent{
+			Kind:  protocol.MarkupKindMarkdown,
+			Value: hoverInfo,
+		},
+	}, nil
+}
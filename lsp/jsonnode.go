@@ -0,0 +1,585 @@
+package lsp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+type JsonKind int
+
+const (
+	JsonInvalid JsonKind = iota
+	JsonObject
+	JsonArray
+	JsonString
+	JsonNumber
+	JsonBool
+	JsonNull
+)
+
+func (kind JsonKind) String() string {
+	switch kind {
+	case JsonObject:
+		return "object"
+	case JsonArray:
+		return "array"
+	case JsonString:
+		return "string"
+	case JsonNumber:
+		return "number"
+	case JsonBool:
+		return "boolean"
+	case JsonNull:
+		return "null"
+	default:
+		return "invalid"
+	}
+}
+
+// JsonNode is a JSON value with the byte offsets it spans in the source
+type JsonNode struct {
+	Kind    JsonKind
+	Start   int
+	End     int
+	Value   string
+	Members []*JsonMember
+	Items   []*JsonNode
+	Parent  *JsonNode
+	Closed  bool
+}
+
+// JsonMember is one "key": value pair of an object
+type JsonMember struct {
+	Key      string
+	KeyStart int
+	KeyEnd   int
+	Value    *JsonNode
+}
+
+// JsonError is the first syntax error found while parsing
+type JsonError struct {
+	Offset  int
+	Message string
+}
+
+type jsonParser struct {
+	content string
+	offset  int
+	err     *JsonError
+}
+
+// parseJsonNode parses content and keeps whatever was built before the
+// first syntax error, so that half typed documents can still be inspected
+func parseJsonNode(content string) (*JsonNode, *JsonError) {
+	parser := &jsonParser{content: content}
+
+	parser.skipSpace()
+	root := parser.parseValue(nil)
+
+	if parser.err == nil {
+		parser.skipSpace()
+		if parser.offset < len(content) {
+			parser.fail("unexpected content after JSON value")
+		}
+	}
+
+	return root, parser.err
+}
+
+func (parser *jsonParser) fail(message string) {
+	if parser.err != nil {
+		return
+	}
+
+	parser.err = &JsonError{Offset: parser.offset, Message: message}
+}
+
+func (parser *jsonParser) skipSpace() {
+	for parser.offset < len(parser.content) {
+		switch parser.content[parser.offset] {
+		case ' ', '\t', '\n', '\r':
+			parser.offset++
+		default:
+			return
+		}
+	}
+}
+
+func (parser *jsonParser) peek() byte {
+	if parser.offset >= len(parser.content) {
+		return 0
+	}
+
+	return parser.content[parser.offset]
+}
+
+func (parser *jsonParser) parseValue(parent *JsonNode) *JsonNode {
+	switch c := parser.peek(); {
+	case c == '{':
+		return parser.parseObject(parent)
+	case c == '[':
+		return parser.parseArray(parent)
+	case c == '"':
+		return parser.parseString(parent)
+	case c == '-' || (c >= '0' && c <= '9'):
+		return parser.parseNumber(parent)
+	case c == 't' || c == 'f' || c == 'n':
+		return parser.parseLiteral(parent)
+	case c == 0:
+		parser.fail("unexpected end of JSON")
+	default:
+		parser.fail(fmt.Sprintf("unexpected character '%c'", c))
+	}
+
+	return nil
+}
+
+func (parser *jsonParser) parseObject(parent *JsonNode) *JsonNode {
+	node := &JsonNode{Kind: JsonObject, Start: parser.offset, Parent: parent}
+	parser.offset++
+
+	// unterminated containers run to the end of the document
+	defer func() {
+		node.End = parser.offset
+		if !node.Closed {
+			node.End = len(parser.content)
+		}
+	}()
+
+	parser.skipSpace()
+	if parser.peek() == '}' {
+		parser.offset++
+		node.Closed = true
+		return node
+	}
+
+	for {
+		parser.skipSpace()
+
+		if parser.peek() != '"' {
+			parser.fail("expected property name")
+			return node
+		}
+
+		key := parser.parseString(node)
+		member := &JsonMember{Key: key.Value, KeyStart: key.Start, KeyEnd: key.End}
+		node.Members = append(node.Members, member)
+
+		if parser.err != nil {
+			return node
+		}
+
+		parser.skipSpace()
+		if parser.peek() != ':' {
+			parser.fail("expected ':' after property name")
+			return node
+		}
+
+		parser.offset++
+		parser.skipSpace()
+
+		member.Value = parser.parseValue(node)
+		if parser.err != nil {
+			return node
+		}
+
+		parser.skipSpace()
+
+		switch parser.peek() {
+		case ',':
+			parser.offset++
+		case '}':
+			parser.offset++
+			node.Closed = true
+			return node
+		default:
+			parser.fail("expected ',' or '}'")
+			return node
+		}
+	}
+}
+
+func (parser *jsonParser) parseArray(parent *JsonNode) *JsonNode {
+	node := &JsonNode{Kind: JsonArray, Start: parser.offset, Parent: parent}
+	parser.offset++
+
+	// unterminated containers run to the end of the document
+	defer func() {
+		node.End = parser.offset
+		if !node.Closed {
+			node.End = len(parser.content)
+		}
+	}()
+
+	parser.skipSpace()
+	if parser.peek() == ']' {
+		parser.offset++
+		node.Closed = true
+		return node
+	}
+
+	for {
+		parser.skipSpace()
+
+		item := parser.parseValue(node)
+		if item != nil {
+			node.Items = append(node.Items, item)
+		}
+
+		if parser.err != nil {
+			return node
+		}
+
+		parser.skipSpace()
+
+		switch parser.peek() {
+		case ',':
+			parser.offset++
+		case ']':
+			parser.offset++
+			node.Closed = true
+			return node
+		default:
+			parser.fail("expected ',' or ']'")
+			return node
+		}
+	}
+}
+
+func (parser *jsonParser) parseString(parent *JsonNode) *JsonNode {
+	node := &JsonNode{Kind: JsonString, Start: parser.offset, Parent: parent}
+	parser.offset++
+
+	for parser.offset < len(parser.content) {
+		switch parser.content[parser.offset] {
+		case '\\':
+			parser.offset += 2
+		case '"':
+			parser.offset++
+			node.End = parser.offset
+			node.Closed = true
+
+			value, err := strconv.Unquote(parser.content[node.Start:node.End])
+			if err != nil {
+				value = parser.content[node.Start+1 : node.End-1]
+			}
+
+			node.Value = value
+
+			return node
+		case '\n':
+			node.End = parser.offset
+			node.Value = parser.content[node.Start+1 : node.End]
+			parser.fail("unterminated string")
+
+			return node
+		default:
+			parser.offset++
+		}
+	}
+
+	parser.offset = len(parser.content)
+	node.End = parser.offset
+	node.Value = parser.content[node.Start+1 : node.End]
+	parser.fail("unterminated string")
+
+	return node
+}
+
+func (parser *jsonParser) parseNumber(parent *JsonNode) *JsonNode {
+	node := &JsonNode{Kind: JsonNumber, Start: parser.offset, Parent: parent}
+
+	for parser.offset < len(parser.content) &&
+		strings.IndexByte("+-0123456789.eE", parser.content[parser.offset]) != -1 {
+
+		parser.offset++
+	}
+
+	node.End = parser.offset
+	node.Value = parser.content[node.Start:node.End]
+	node.Closed = true
+
+	if _, err := strconv.ParseFloat(node.Value, 64); err != nil {
+		parser.offset = node.Start
+		parser.fail("invalid number")
+	}
+
+	return node
+}
+
+func (parser *jsonParser) parseLiteral(parent *JsonNode) *JsonNode {
+	for literal, kind := range map[string]JsonKind{
+		"true":  JsonBool,
+		"false": JsonBool,
+		"null":  JsonNull,
+	} {
+
+		if strings.HasPrefix(parser.content[parser.offset:], literal) {
+			node := &JsonNode{
+				Kind:   kind,
+				Start:  parser.offset,
+				End:    parser.offset + len(literal),
+				Value:  literal,
+				Parent: parent,
+				Closed: true,
+			}
+
+			parser.offset = node.End
+
+			return node
+		}
+	}
+
+	parser.fail("invalid literal")
+
+	return nil
+}
+
+// Member returns the value of key in an object node, or nil
+func (node *JsonNode) Member(key string) *JsonNode {
+	if node == nil || node.Kind != JsonObject {
+		return nil
+	}
+
+	for _, member := range node.Members {
+		if member.Key == key {
+			return member.Value
+		}
+	}
+
+	return nil
+}
+
+// ParentMember returns the object member holding node, looking through
+// an enclosing array
+func (node *JsonNode) ParentMember() *JsonMember {
+	parent := node.Parent
+	if parent != nil && parent.Kind == JsonArray {
+		node = parent
+		parent = parent.Parent
+	}
+
+	if parent == nil || parent.Kind != JsonObject {
+		return nil
+	}
+
+	for _, member := range parent.Members {
+		if member.Value == node {
+			return member
+		}
+	}
+
+	return nil
+}
+
+// EnclosingObject returns the nearest object containing node
+func (node *JsonNode) EnclosingObject() *JsonNode {
+	parent := node.Parent
+	for parent != nil && parent.Kind != JsonObject {
+		parent = parent.Parent
+	}
+
+	return parent
+}
+
+// findJsonSchema returns the .ti-config schema name of an object node
+func findJsonSchema(node *JsonNode) string {
+	if node == nil {
+		return ""
+	}
+
+	if node.Parent == nil {
+		return "class"
+	}
+
+	member := node.ParentMember()
+	if member == nil {
+		return ""
+	}
+
+	return configSchemas[findJsonSchema(node.EnclosingObject())][member.Key].Schema
+}
+
+func offsetToPosition(content string, offset int) protocol.Position {
+	if offset > len(content) {
+		offset = len(content)
+	}
+
+	before := content[:offset]
+	line := strings.Count(before, "\n")
+	lineStart := strings.LastIndex(before, "\n") + 1
+
+	// LSP columns count UTF-16 code units
+	character := 0
+	for _, r := range before[lineStart:] {
+		character += utf16.RuneLen(r)
+	}
+
+	return protocol.Position{
+		Line:      uint32(line),
+		Character: uint32(character),
+	}
+}
+
+func positionToOffset(content string, position protocol.Position) int {
+	offset := 0
+
+	for line := uint32(0); line < position.Line; line++ {
+		idx := strings.IndexByte(content[offset:], '\n')
+		if idx == -1 {
+			return len(content)
+		}
+
+		offset += idx + 1
+	}
+
+	for character := uint32(0); character < position.Character && offset < len(content); {
+		if content[offset] == '\n' {
+			break
+		}
+
+		r, size := utf8.DecodeRuneInString(content[offset:])
+		offset += size
+		character += uint32(utf16.RuneLen(r))
+	}
+
+	return offset
+}
+
+func makeOffsetRange(content string, start int, end int) protocol.Range {
+	return protocol.Range{
+		Start: offsetToPosition(content, start),
+		End:   offsetToPosition(content, end),
+	}
+}
+
+// JsonCursor describes where the cursor is in a .ti-config document
+type JsonCursor struct {
+	Object   *JsonNode
+	Schema   string
+	Member   *JsonMember
+	Node     *JsonNode
+	InKey    bool
+	InString bool
+}
+
+func (node *JsonNode) contains(offset int) bool {
+	if node == nil || offset <= node.Start {
+		return false
+	}
+
+	return offset < node.End || offset == node.End && !node.Closed
+}
+
+func (member *JsonMember) keyContains(content string, offset int) bool {
+	if offset <= member.KeyStart {
+		return false
+	}
+
+	closed := member.KeyEnd-member.KeyStart > 1 && content[member.KeyEnd-1] == '"'
+
+	return offset < member.KeyEnd || offset == member.KeyEnd && !closed
+}
+
+// findJsonCursor walks the config schema down to the object holding offset
+func findJsonCursor(root *JsonNode, content string, offset int) *JsonCursor {
+	if root == nil || root.Kind != JsonObject || !root.contains(offset) {
+		return nil
+	}
+
+	node := root
+	schema := "class"
+
+	for {
+		cursor := &JsonCursor{Object: node, Schema: schema}
+
+		var next *JsonNode
+		var nextSchema string
+
+		for _, member := range node.Members {
+			if member.keyContains(content, offset) {
+				cursor.Member = member
+				cursor.InKey = true
+				cursor.InString = true
+
+				return cursor
+			}
+
+			value := member.Value
+			field := configSchemas[schema][member.Key]
+
+			if value == nil {
+				if offset > member.KeyEnd &&
+					strings.Contains(content[member.KeyEnd:offset], ":") {
+
+					cursor.Member = member
+					return cursor
+				}
+
+				continue
+			}
+
+			switch value.Kind {
+			case JsonObject:
+				if value.contains(offset) {
+					next = value
+					nextSchema = field.Schema
+				}
+
+			case JsonArray:
+				if !value.contains(offset) {
+					continue
+				}
+
+				cursor.Member = member
+
+				for _, item := range value.Items {
+					if !item.contains(offset) {
+						continue
+					}
+
+					switch item.Kind {
+					case JsonObject:
+						next = item
+						nextSchema = field.Schema
+					case JsonString:
+						cursor.Node = item
+						cursor.InString = true
+					}
+				}
+
+				if next == nil {
+					return cursor
+				}
+
+			case JsonString:
+				if value.contains(offset) {
+					cursor.Member = member
+					cursor.Node = value
+					cursor.InString = true
+
+					return cursor
+				}
+
+			default:
+				if offset > value.Start && offset <= value.End {
+					cursor.Member = member
+					cursor.Node = value
+					return cursor
+				}
+			}
+		}
+
+		if next == nil {
+			return cursor
+		}
+
+		node = next
+		schema = nextSchema
+	}
+}
@@ -0,0 +1,168 @@
+package lsp
+
+import (
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestParseJsonNode(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		kind     JsonKind
+		keys     []string
+		closed   bool
+		errorAt  int
+		errorMsg string
+	}{
+		{
+			name:    "object",
+			content: `{"class": "Foo", "extends": ["Bar"]}`,
+			kind:    JsonObject,
+			keys:    []string{"class", "extends"},
+			closed:  true,
+			errorAt: -1,
+		},
+		{
+			name:    "empty object",
+			content: ` {} `,
+			kind:    JsonObject,
+			closed:  true,
+			errorAt: -1,
+		},
+		{
+			name:     "unterminated object",
+			content:  `{"class": "Foo",`,
+			kind:     JsonObject,
+			keys:     []string{"class"},
+			errorAt:  16,
+			errorMsg: "expected property name",
+		},
+		{
+			name:     "missing colon",
+			content:  `{"class" "Foo"}`,
+			kind:     JsonObject,
+			keys:     []string{"class"},
+			errorAt:  9,
+			errorMsg: "expected ':' after property name",
+		},
+		{
+			name:     "trailing content",
+			content:  `{} x`,
+			kind:     JsonObject,
+			closed:   true,
+			errorAt:  3,
+			errorMsg: "unexpected content after JSON value",
+		},
+		{
+			name:     "unterminated string",
+			content:  "{\"cla\n",
+			kind:     JsonObject,
+			keys:     []string{"cla"},
+			errorAt:  5,
+			errorMsg: "unterminated string",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, err := parseJsonNode(test.content)
+
+			if root == nil || root.Kind != test.kind {
+				t.Fatalf("root = %v, want kind %v", root, test.kind)
+			}
+
+			if root.Closed != test.closed {
+				t.Errorf("Closed = %v, want %v", root.Closed, test.closed)
+			}
+
+			var keys []string
+			for _, member := range root.Members {
+				keys = append(keys, member.Key)
+			}
+
+			if len(keys) != len(test.keys) {
+				t.Fatalf("keys = %v, want %v", keys, test.keys)
+			}
+
+			for i := range keys {
+				if keys[i] != test.keys[i] {
+					t.Errorf("keys = %v, want %v", keys, test.keys)
+				}
+			}
+
+			switch {
+			case test.errorAt == -1 && err != nil:
+				t.Errorf("unexpected error %v", err)
+			case test.errorAt != -1 && err == nil:
+				t.Errorf("expected error at %d", test.errorAt)
+			case err != nil && (err.Offset != test.errorAt || err.Message != test.errorMsg):
+				t.Errorf("error = %d %q, want %d %q", err.Offset, err.Message, test.errorAt, test.errorMsg)
+			}
+		})
+	}
+}
+
+func TestParseJsonNodeOffsets(t *testing.T) {
+	content := `{"name": "to_s", "arguments": [{"type": ["Int"]}]}`
+
+	root, err := parseJsonNode(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		node *JsonNode
+		kind JsonKind
+		text string
+	}{
+		{root, JsonObject, content},
+		{root.Member("name"), JsonString, `"to_s"`},
+		{root.Member("arguments"), JsonArray, `[{"type": ["Int"]}]`},
+		{root.Member("arguments").Items[0].Member("type").Items[0], JsonString, `"Int"`},
+	}
+
+	for _, test := range tests {
+		if test.node == nil {
+			t.Fatalf("missing node for %s", test.text)
+		}
+
+		if test.node.Kind != test.kind {
+			t.Errorf("%s: kind = %v, want %v", test.text, test.node.Kind, test.kind)
+		}
+
+		if got := content[test.node.Start:test.node.End]; got != test.text {
+			t.Errorf("span = %s, want %s", got, test.text)
+		}
+	}
+}
+
+func TestOffsetPosition(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		offset   int
+		position protocol.Position
+	}{
+		{"start", "abc", 0, protocol.Position{Line: 0, Character: 0}},
+		{"ascii", "abc\ndef", 6, protocol.Position{Line: 1, Character: 2}},
+		{"line start", "abc\ndef", 4, protocol.Position{Line: 1, Character: 0}},
+		{"two byte rune", "\"é\": 1", 3, protocol.Position{Line: 0, Character: 2}},
+		{"three byte rune", "\"日本\"", 7, protocol.Position{Line: 0, Character: 3}},
+		{"surrogate pair", "\"😀\": 1", 5, protocol.Position{Line: 0, Character: 3}},
+		{"after surrogate pair", "x\n😀y", 6, protocol.Position{Line: 1, Character: 2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := offsetToPosition(test.content, test.offset); got != test.position {
+				t.Errorf("offsetToPosition = %+v, want %+v", got, test.position)
+			}
+
+			if got := positionToOffset(test.content, test.position); got != test.offset {
+				t.Errorf("positionToOffset = %d, want %d", got, test.offset)
+			}
+		})
+	}
+}
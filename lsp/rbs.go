@@ -0,0 +1,936 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	rbsClassPattern = regexp.MustCompile(`^(class|module)\s+((?:::)?[A-Z][\w:]*)\s*(\[[^\]]*\])?\s*(?:<\s*((?:::)?[A-Z][\w:]*))?`)
+
+	rbsInterfacePattern = regexp.MustCompile(`^interface\s+(?:[\w:]*::)?(_\w+)`)
+
+	rbsDefPattern = regexp.MustCompile(`^def\s+(self\??\.)?(\S+?)\s*:\s*(.*)$`)
+
+	rbsAttrPattern = regexp.MustCompile(`^attr_(reader|writer|accessor)\s+(self\.)?([a-z_]\w*)\s*(?:\([^)]*\))?\s*:\s*(.+)$`)
+
+	rbsIncludePattern = regexp.MustCompile(`^(?:include|extend|prepend)\s+((?:::)?[A-Z][\w:]*)`)
+
+	rbsConstantPattern = regexp.MustCompile(`^((?:::)?[A-Z][\w:]*)\s*:\s*(.+)$`)
+
+	rbsAliasPattern = regexp.MustCompile(`^alias\s+(self\.)?(\S+)\s+(?:self\.)?(\S+)$`)
+
+	rbsKeywordPattern = regexp.MustCompile(`^(\?)?([a-z_]\w*[?!]?):\s+(.+)$`)
+
+	rbsParamNamePattern = regexp.MustCompile(`\s+([a-z_]\w*)$`)
+)
+
+// RBS types with a direct ti counterpart
+var rbsTypeNames = map[string]string{
+	"Integer":     "Int",
+	"Float":       "Float",
+	"String":      "String",
+	"Symbol":      "Symbol",
+	"Numeric":     "Number",
+	"Range":       "Range",
+	"Hash":        "Hash",
+	"Array":       "Array",
+	"Proc":        "Block",
+	"Method":      "Block",
+	"NilClass":    "NilClass",
+	"TrueClass":   "Bool",
+	"FalseClass":  "Bool",
+	"Object":      "Untyped",
+	"BasicObject": "Untyped",
+	"nil":         "NilClass",
+	"void":        "NilClass",
+	"bool":        "Bool",
+	"boolish":     "Bool",
+	"true":        "Bool",
+	"false":       "Bool",
+	"untyped":     "Untyped",
+	"top":         "Untyped",
+	"bot":         "Untyped",
+	"self":        "Self",
+}
+
+// element types ti has a dedicated array type for
+var rbsArrayTypeNames = map[string]string{
+	"Int":    "IntArray",
+	"Float":  "FloatArray",
+	"String": "StringArray",
+}
+
+// RbsIssue is an RBS construct that has no .ti-config equivalent
+type RbsIssue struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (issue RbsIssue) String() string {
+	return fmt.Sprintf("%s:%d: %s", issue.Path, issue.Line+1, issue.Message)
+}
+
+// rbsStatement is one declaration, joined over continuation lines
+type rbsStatement struct {
+	Line     int
+	Text     string
+	Document string
+}
+
+// rbsDeclaration is an open class, module or interface
+type rbsDeclaration struct {
+	Config     *TiClassConfig
+	Name       string
+	TypeParams []string
+}
+
+type rbsImporter struct {
+	path    string
+	configs []*TiClassConfig
+	stack   []*rbsDeclaration
+	issues  []RbsIssue
+	line    int
+}
+
+func (importer *rbsImporter) report(format string, args ...any) {
+	importer.issues = append(importer.issues, RbsIssue{
+		Path:    importer.path,
+		Line:    importer.line,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// splitRbsStatements joins declarations spread over several lines and
+// attaches the comment block written above each of them
+func splitRbsStatements(content string) []rbsStatement {
+	var statements []rbsStatement
+	var comments []string
+
+	depth := 0
+
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if comment, ok := strings.CutPrefix(trimmed, "#"); ok && depth == 0 {
+			comments = append(comments, strings.TrimPrefix(comment, " "))
+			continue
+		}
+
+		if idx := strings.Index(trimmed, " #"); idx != -1 {
+			trimmed = strings.TrimSpace(trimmed[:idx])
+		}
+
+		if trimmed == "" {
+			if depth == 0 {
+				comments = nil
+			}
+
+			continue
+		}
+
+		continues := depth > 0 ||
+			len(statements) > 0 && (strings.HasPrefix(trimmed, "|") || strings.HasPrefix(trimmed, "->"))
+
+		if continues {
+			last := &statements[len(statements)-1]
+			last.Text += " " + trimmed
+		} else {
+			statements = append(statements, rbsStatement{
+				Line:     i,
+				Text:     trimmed,
+				Document: strings.Join(comments, "\n"),
+			})
+
+			comments = nil
+		}
+
+		for _, c := range trimmed {
+			switch c {
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}':
+				depth--
+			}
+		}
+
+		depth = max(depth, 0)
+	}
+
+	return statements
+}
+
+// splitRbsTopLevel splits s at sep outside of brackets
+func splitRbsTopLevel(s string, sep string) []string {
+	var parts []string
+
+	depth := 0
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		default:
+			if depth == 0 && strings.HasPrefix(s[i:], sep) {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + len(sep)
+			}
+		}
+	}
+
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
+// findRbsClosing returns the index of the bracket closing s[0]
+func findRbsClosing(s string) int {
+	depth := 0
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+func (importer *rbsImporter) current() *rbsDeclaration {
+	if len(importer.stack) == 0 {
+		return nil
+	}
+
+	return importer.stack[len(importer.stack)-1]
+}
+
+func (importer *rbsImporter) isTypeParam(name string, methodParams []string) bool {
+	if slices.Contains(methodParams, name) {
+		return true
+	}
+
+	for _, declaration := range importer.stack {
+		if slices.Contains(declaration.TypeParams, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mapType converts an RBS type to ti type names, reporting whether it
+// is optional (`T?` or a union with nil)
+func (importer *rbsImporter) mapType(rbsType string, methodParams []string) ([]string, bool) {
+	rbsType = strings.TrimSpace(rbsType)
+
+	members := splitRbsTopLevel(rbsType, "|")
+	if len(members) > 1 {
+		var types []string
+		optional := false
+
+		for _, member := range members {
+			memberTypes, memberOptional := importer.mapType(member, methodParams)
+			optional = optional || memberOptional
+
+			for _, typeName := range memberTypes {
+				if typeName == "NilClass" {
+					optional = true
+					continue
+				}
+
+				types = appendUnique(types, typeName)
+			}
+		}
+
+		if len(types) == 0 {
+			types = []string{"NilClass"}
+			optional = false
+		}
+
+		return types, optional
+	}
+
+	if strings.HasSuffix(rbsType, "?") {
+		types, _ := importer.mapType(strings.TrimSuffix(rbsType, "?"), methodParams)
+		return types, true
+	}
+
+	if strings.HasPrefix(rbsType, "(") && findRbsClosing(rbsType) == len(rbsType)-1 {
+		return importer.mapType(rbsType[1:len(rbsType)-1], methodParams)
+	}
+
+	switch {
+	case rbsType == "":
+		return []string{"Untyped"}, false
+	case strings.HasPrefix(rbsType, "^"):
+		return []string{"Block"}, false
+	case strings.HasPrefix(rbsType, "["):
+		return []string{"Array"}, false
+	case strings.HasPrefix(rbsType, "{"):
+		return []string{"Hash"}, false
+	case strings.HasPrefix(rbsType, `"`) || strings.HasPrefix(rbsType, "'"):
+		return []string{"String"}, false
+	case strings.HasPrefix(rbsType, ":"):
+		return []string{"Symbol"}, false
+	case integerPattern.MatchString(rbsType):
+		return []string{"Int"}, false
+	}
+
+	name := strings.TrimPrefix(rbsType, "::")
+
+	var args []string
+	if idx := strings.Index(name, "["); idx != -1 && strings.HasSuffix(name, "]") {
+		args = splitRbsTopLevel(name[idx+1:len(name)-1], ",")
+		name = name[:idx]
+	}
+
+	switch {
+	case name == "instance":
+		if current := importer.current(); current != nil && current.Config != nil {
+			return []string{current.Config.Class}, false
+		}
+
+		return []string{"Self"}, false
+
+	case name == "class" || name == "singleton":
+		importer.report("'%s' type mapped to Untyped", rbsType)
+		return []string{"Untyped"}, false
+
+	case name == "Array" && len(args) == 1:
+		elementTypes, _ := importer.mapType(args[0], methodParams)
+		if len(elementTypes) == 1 {
+			if arrayType, ok := rbsArrayTypeNames[elementTypes[0]]; ok {
+				return []string{arrayType}, false
+			}
+		}
+
+		return []string{"Array"}, false
+	}
+
+	if typeName, ok := rbsTypeNames[name]; ok {
+		return []string{typeName}, false
+	}
+
+	if importer.isTypeParam(name, methodParams) {
+		return []string{"Untyped"}, false
+	}
+
+	last, _ := splitNamespace(name)
+
+	switch {
+	case strings.HasPrefix(last, "_"):
+		importer.report("interface type '%s' mapped to Untyped", name)
+		return []string{"Untyped"}, false
+
+	case last != "" && last[0] >= 'a' && last[0] <= 'z':
+		importer.report("type alias '%s' mapped to Untyped", name)
+		return []string{"Untyped"}, false
+	}
+
+	return []string{name}, false
+}
+
+// mapSingleType maps an RBS type to the one ti type a block parameter takes
+func (importer *rbsImporter) mapSingleType(rbsType string, methodParams []string) string {
+	types, optional := importer.mapType(rbsType, methodParams)
+	if len(types) != 1 || optional {
+		return "Untyped"
+	}
+
+	return types[0]
+}
+
+// stripRbsParamName drops the optional name after a parameter type:
+// `Integer count` -> `Integer`
+func stripRbsParamName(param string) string {
+	matches := rbsParamNamePattern.FindStringSubmatch(param)
+	if matches == nil || strings.TrimSuffix(param, matches[0]) == "" {
+		return param
+	}
+
+	if _, isTypeName := rbsTypeNames[matches[1]]; isTypeName ||
+		slices.Contains([]string{"instance", "class", "singleton"}, matches[1]) {
+
+		return param
+	}
+
+	return strings.TrimSuffix(param, matches[0])
+}
+
+// parseParam converts one RBS parameter into a TiArgument
+func (importer *rbsImporter) parseParam(param string, methodParams []string) (TiArgument, bool) {
+	if matches := rbsKeywordPattern.FindStringSubmatch(param); matches != nil {
+		types, optional := importer.mapType(stripRbsParamName(matches[3]), methodParams)
+		if optional {
+			types = appendUnique(types, "NilClass")
+		}
+
+		return TiArgument{Type: types, Key: matches[2]}, true
+	}
+
+	if strings.HasPrefix(param, "**") {
+		return TiArgument{Type: []string{"Hash"}}, true
+	}
+
+	isAsterisk := strings.HasPrefix(param, "*")
+	isOptional := strings.HasPrefix(param, "?")
+
+	types, optional := importer.mapType(stripRbsParamName(strings.TrimLeft(param, "*?")), methodParams)
+	if optional {
+		types = appendUnique(types, "NilClass")
+	}
+
+	if isOptional {
+		// ti marks positional arguments with a default by a Default type
+		if len(types) == 1 && slices.Contains(
+			[]string{"Int", "Float", "String", "Bool", "Block", "Untyped"},
+			types[0],
+		) {
+
+			types = []string{"Default" + types[0]}
+		} else {
+			importer.report("optional argument '%s' is imported as required", param)
+		}
+	}
+
+	return TiArgument{Type: types, IsAsterisk: isAsterisk}, true
+}
+
+// parseMethodType converts `[T] (params) { (block) -> R } -> R`
+func (importer *rbsImporter) parseMethodType(methodType string) (*TiMethod, bool) {
+	method := &TiMethod{Arguments: []TiArgument{}}
+
+	rest := strings.TrimSpace(methodType)
+
+	var methodParams []string
+
+	if strings.HasPrefix(rest, "[") {
+		end := findRbsClosing(rest)
+		if end == -1 {
+			return nil, false
+		}
+
+		for _, param := range splitRbsTopLevel(rest[1:end], ",") {
+			if fields := strings.Fields(param); len(fields) > 0 {
+				methodParams = append(methodParams, fields[0])
+			}
+		}
+
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+
+	if strings.HasPrefix(rest, "(") {
+		end := findRbsClosing(rest)
+		if end == -1 {
+			return nil, false
+		}
+
+		if params := strings.TrimSpace(rest[1:end]); params != "" {
+			for _, param := range splitRbsTopLevel(params, ",") {
+				if param == "..." {
+					importer.report("'...' arguments are not translated")
+					continue
+				}
+
+				argument, ok := importer.parseParam(param, methodParams)
+				if !ok {
+					return nil, false
+				}
+
+				method.Arguments = append(method.Arguments, argument)
+			}
+		}
+
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+
+	if strings.HasPrefix(rest, "?{") || strings.HasPrefix(rest, "{") {
+		rest = strings.TrimPrefix(rest, "?")
+
+		end := findRbsClosing(rest)
+		if end == -1 {
+			return nil, false
+		}
+
+		block := strings.TrimSpace(rest[1:end])
+
+		method.BlockParameters = []string{}
+
+		if strings.HasPrefix(block, "(") {
+			if blockEnd := findRbsClosing(block); blockEnd != -1 {
+				for _, param := range splitRbsTopLevel(block[1:blockEnd], ",") {
+					if param == "" {
+						continue
+					}
+
+					method.BlockParameters = append(
+						method.BlockParameters,
+						importer.mapSingleType(stripRbsParamName(strings.TrimLeft(param, "*?")), methodParams),
+					)
+				}
+			}
+		}
+
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+
+	returnType, ok := strings.CutPrefix(rest, "->")
+	if !ok {
+		return nil, false
+	}
+
+	types, optional := importer.mapType(returnType, methodParams)
+
+	method.ReturnType = TiReturnType{Type: types, IsConditional: optional}
+
+	return method, true
+}
+
+// mergeOverloads folds the overloads of a method into one signature, ti
+// has a single signature per method
+func (importer *rbsImporter) mergeOverloads(name string, overloads []*TiMethod) TiMethod {
+	method := *overloads[0]
+	method.Arguments = slices.Clone(method.Arguments)
+
+	for i, overload := range overloads[1:] {
+		sameShape := len(overload.Arguments) == len(method.Arguments)
+
+		for j := 0; sameShape && j < len(overload.Arguments); j++ {
+			sameShape = overload.Arguments[j].Key == method.Arguments[j].Key &&
+				overload.Arguments[j].IsAsterisk == method.Arguments[j].IsAsterisk
+		}
+
+		if !sameShape {
+			importer.report("overload %d of '%s' has different arguments and was dropped", i+2, name)
+			continue
+		}
+
+		for j, argument := range overload.Arguments {
+			method.Arguments[j].Type = appendUnique(slices.Clone(method.Arguments[j].Type), argument.Type...)
+		}
+
+		method.ReturnType.Type = appendUnique(slices.Clone(method.ReturnType.Type), overload.ReturnType.Type...)
+		method.ReturnType.IsConditional = method.ReturnType.IsConditional || overload.ReturnType.IsConditional
+	}
+
+	return method
+}
+
+// addMethod adds method to the instance or class side, replacing a
+// previous declaration of the same name
+func addMethod(classConfig *TiClassConfig, method TiMethod, isClassMethod bool) {
+	methods := &classConfig.InstanceMethods
+	if isClassMethod {
+		methods = &classConfig.ClassMethods
+	}
+
+	for i := range *methods {
+		if (*methods)[i].Name == method.Name {
+			(*methods)[i] = method
+			return
+		}
+	}
+
+	*methods = append(*methods, method)
+}
+
+func findMethod(classConfig *TiClassConfig, name string, isClassMethod bool) *TiMethod {
+	methods := classConfig.InstanceMethods
+	if isClassMethod {
+		methods = classConfig.ClassMethods
+	}
+
+	for i := range methods {
+		if methods[i].Name == name {
+			return &methods[i]
+		}
+	}
+
+	return nil
+}
+
+func (importer *rbsImporter) openDeclaration(name string, typeParams string) *TiClassConfig {
+	fullName := strings.TrimPrefix(name, "::")
+	if current := importer.current(); current != nil && !strings.HasPrefix(name, "::") {
+		fullName = current.Name + "::" + fullName
+	}
+
+	declaration := &rbsDeclaration{Name: fullName}
+
+	if typeParams != "" {
+		for _, param := range splitRbsTopLevel(strings.Trim(typeParams, "[]"), ",") {
+			fields := strings.Fields(param)
+
+			// [unchecked out T < Bound]
+			for _, field := range fields {
+				if field != "unchecked" && field != "in" && field != "out" {
+					declaration.TypeParams = append(declaration.TypeParams, field)
+					break
+				}
+			}
+		}
+	}
+
+	for _, classConfig := range importer.configs {
+		if classConfig.Class == fullName {
+			declaration.Config = classConfig
+		}
+	}
+
+	if declaration.Config == nil {
+		declaration.Config = &TiClassConfig{
+			Frame:           "Builtin",
+			Class:           fullName,
+			Extends:         []string{},
+			InstanceMethods: []TiMethod{},
+			ClassMethods:    []TiMethod{},
+			Constants:       []TiConstantType{},
+		}
+
+		importer.configs = append(importer.configs, declaration.Config)
+	}
+
+	importer.stack = append(importer.stack, declaration)
+
+	return declaration.Config
+}
+
+func (importer *rbsImporter) importDef(matches []string, document string, classConfig *TiClassConfig) {
+	name := matches[2]
+
+	var overloads []*TiMethod
+
+	for _, methodType := range splitRbsOverloads(matches[3]) {
+		if methodType == "..." {
+			continue
+		}
+
+		method, ok := importer.parseMethodType(methodType)
+		if !ok {
+			importer.report("cannot parse signature of '%s': %s", name, methodType)
+			continue
+		}
+
+		overloads = append(overloads, method)
+	}
+
+	if len(overloads) == 0 {
+		return
+	}
+
+	method := importer.mergeOverloads(name, overloads)
+	method.Name = name
+	method.Document = document
+
+	switch {
+	case matches[1] == "" && name == "initialize":
+		// ti models construction as the class method new
+		method.Name = "new"
+		method.ReturnType = TiReturnType{Type: []string{classConfig.Class}}
+		addMethod(classConfig, method, true)
+
+	case matches[1] == "self?.":
+		addMethod(classConfig, method, false)
+		addMethod(classConfig, method, true)
+
+	default:
+		addMethod(classConfig, method, matches[1] == "self.")
+	}
+}
+
+// splitRbsOverloads splits `(A) -> B | (C) -> D` into its method types,
+// keeping `-> A | B` unions together
+func splitRbsOverloads(methodTypes string) []string {
+	var overloads []string
+
+	for _, part := range splitRbsTopLevel(methodTypes, "|") {
+		isMethodType := !strings.HasPrefix(part, "^") &&
+			(len(splitRbsTopLevel(part, "->")) > 1 || part == "...")
+
+		if isMethodType || len(overloads) == 0 {
+			overloads = append(overloads, part)
+			continue
+		}
+
+		overloads[len(overloads)-1] += " | " + part
+	}
+
+	return overloads
+}
+
+func (importer *rbsImporter) importStatement(statement rbsStatement) {
+	importer.line = statement.Line
+
+	text := statement.Text
+	for _, prefix := range []string{"public ", "private ", "overload "} {
+		text = strings.TrimPrefix(text, prefix)
+	}
+
+	current := importer.current()
+
+	var classConfig *TiClassConfig
+	if current != nil {
+		classConfig = current.Config
+	}
+
+	switch {
+	case text == "end":
+		if current == nil {
+			importer.report("unbalanced 'end'")
+			return
+		}
+
+		importer.stack = importer.stack[:len(importer.stack)-1]
+
+	case rbsClassPattern.MatchString(text):
+		matches := rbsClassPattern.FindStringSubmatch(text)
+
+		config := importer.openDeclaration(matches[2], matches[3])
+		if matches[4] != "" {
+			config.Extends = appendUnique(config.Extends, strings.TrimPrefix(matches[4], "::"))
+		}
+
+	case rbsInterfacePattern.MatchString(text):
+		matches := rbsInterfacePattern.FindStringSubmatch(text)
+		importer.report("interface '%s' is not translated", matches[1])
+
+		importer.stack = append(importer.stack, &rbsDeclaration{Name: matches[1]})
+
+	case strings.HasPrefix(text, "type ") || strings.HasPrefix(text, "use "):
+		if strings.HasPrefix(text, "type ") {
+			importer.report("type alias is not translated: %s", text)
+		}
+
+	case classConfig == nil && current != nil:
+		// interface members
+
+	case rbsDefPattern.MatchString(text):
+		if classConfig == nil {
+			importer.report("method outside of a class is not translated")
+			return
+		}
+
+		importer.importDef(rbsDefPattern.FindStringSubmatch(text), statement.Document, classConfig)
+
+	case rbsAttrPattern.MatchString(text):
+		if classConfig == nil {
+			return
+		}
+
+		matches := rbsAttrPattern.FindStringSubmatch(text)
+		isClassMethod := matches[2] != ""
+
+		types, optional := importer.mapType(matches[4], nil)
+
+		if matches[1] != "writer" {
+			addMethod(classConfig, TiMethod{
+				Name:       matches[3],
+				Arguments:  []TiArgument{},
+				ReturnType: TiReturnType{Type: types, IsConditional: optional},
+				Document:   statement.Document,
+			}, isClassMethod)
+		}
+
+		if matches[1] != "reader" {
+			argumentTypes := slices.Clone(types)
+			if optional {
+				argumentTypes = appendUnique(argumentTypes, "NilClass")
+			}
+
+			addMethod(classConfig, TiMethod{
+				Name:       matches[3] + "=",
+				Arguments:  []TiArgument{{Type: argumentTypes}},
+				ReturnType: TiReturnType{Type: types, IsConditional: optional},
+				Document:   statement.Document,
+			}, isClassMethod)
+		}
+
+	case rbsIncludePattern.MatchString(text):
+		if classConfig == nil {
+			return
+		}
+
+		matches := rbsIncludePattern.FindStringSubmatch(text)
+		classConfig.Extends = appendUnique(classConfig.Extends, strings.TrimPrefix(matches[1], "::"))
+
+	case rbsAliasPattern.MatchString(text):
+		if classConfig == nil {
+			return
+		}
+
+		matches := rbsAliasPattern.FindStringSubmatch(text)
+		isClassMethod := matches[1] != ""
+
+		original := findMethod(classConfig, matches[3], isClassMethod)
+		if original == nil {
+			importer.report("alias of unknown method '%s'", matches[3])
+			return
+		}
+
+		method := *original
+		method.Name = matches[2]
+		addMethod(classConfig, method, isClassMethod)
+
+	case rbsConstantPattern.MatchString(text):
+		matches := rbsConstantPattern.FindStringSubmatch(text)
+		if classConfig == nil {
+			importer.report("top level constant '%s' is not translated", matches[1])
+			return
+		}
+
+		types, optional := importer.mapType(matches[2], nil)
+
+		classConfig.Constants = append(classConfig.Constants, TiConstantType{
+			Name:       strings.TrimPrefix(matches[1], "::"),
+			ReturnType: TiReturnType{Type: types, IsConditional: optional},
+		})
+
+	case strings.HasPrefix(text, "@") || text == "public" || text == "private":
+		// instance variables and visibility have no .ti-config counterpart
+
+	default:
+		importer.report("unsupported declaration: %s", text)
+	}
+}
+
+// importRbsFiles converts the declarations of .rbs files into class
+// configs, merging classes reopened across files
+func importRbsFiles(files []string) ([]TiClassConfig, []RbsIssue) {
+	importer := &rbsImporter{}
+
+	for _, file := range files {
+		importer.path = file
+		importer.stack = nil
+		importer.line = 0
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			importer.report("%s", err)
+			continue
+		}
+
+		for _, statement := range splitRbsStatements(string(data)) {
+			importer.importStatement(statement)
+		}
+
+		if len(importer.stack) > 0 {
+			importer.report("'%s' is not closed", importer.current().Name)
+		}
+	}
+
+	var classConfigs []TiClassConfig
+	for _, classConfig := range importer.configs {
+		// namespaces that only hold other classes
+		if len(classConfig.Extends) == 0 && len(classConfig.InstanceMethods) == 0 &&
+			len(classConfig.ClassMethods) == 0 && len(classConfig.Constants) == 0 {
+
+			continue
+		}
+
+		classConfigs = append(classConfigs, *classConfig)
+	}
+
+	return classConfigs, importer.issues
+}
+
+// findRbsFiles expands directories in paths to the .rbs files under them
+func findRbsFiles(paths []string) []string {
+	var files []string
+
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		if !stat.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		filepath.WalkDir(path, func(path string, entry os.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() && strings.HasSuffix(path, ".rbs") {
+				files = append(files, path)
+			}
+
+			return nil
+		})
+	}
+
+	return files
+}
+
+// writeClassConfigFile writes classConfig into configDir, merging into an
+// existing class file without touching its entries
+func writeClassConfigFile(configDir string, classConfig TiClassConfig) error {
+	path := filepath.Join(configDir, strings.ToLower(classConfig.Class)+".json")
+
+	if data, err := os.ReadFile(path); err == nil {
+		merged, ok := mergeClassConfig(string(data), classConfig)
+		if !ok {
+			return fmt.Errorf("cannot merge into %s", path)
+		}
+
+		return os.WriteFile(path, []byte(merged), 0644)
+	}
+
+	jsonData, err := json.MarshalIndent(classConfig, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(jsonData, '\n'), 0644)
+}
+
+// ImportRbs is the import-rbs subcommand: it converts .rbs files and
+// directories into .ti-config class files and prints what was skipped
+func ImportRbs(paths []string) int {
+	files := findRbsFiles(paths)
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: ti-lsp import-rbs <file.rbs|dir>...")
+		return 1
+	}
+
+	status := 0
+
+	classConfigs, issues := importRbsFiles(files)
+
+	// write into the directory the command runs in, not into a parent
+	// project that happens to have a config directory
+	configDir := configDirPath(&workspaceScope{Root: getDefaultRoot()})
+	if len(classConfigs) > 0 {
+		if err := os.MkdirAll(configDir, 0755); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	for _, classConfig := range classConfigs {
+		if err := writeClassConfigFile(configDir, classConfig); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		fmt.Printf("imported %s\n", classConfig.Class)
+	}
+
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+	}
+
+	return status
+}
@@ -0,0 +1,185 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestImportRbsCreatesConfigOnlyWithClasses(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		status  int
+		created bool
+	}{
+		{"no rbs files", map[string]string{"notes.txt": "class Foo\nend\n"}, 1, false},
+		{"nothing to import", map[string]string{"empty.rbs": "interface _Each\nend\n"}, 0, false},
+		{"class", map[string]string{"foo.rbs": "class Foo\n  def bar: () -> String\nend\n"}, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Chdir(dir)
+
+			for name, content := range test.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if status := ImportRbs([]string{dir}); status != test.status {
+				t.Errorf("status = %d, want %d", status, test.status)
+			}
+
+			_, err := os.Stat(filepath.Join(dir, ".ti-config"))
+			if created := err == nil; created != test.created {
+				t.Errorf("created .ti-config = %v, want %v", created, test.created)
+			}
+		})
+	}
+}
+
+func TestImportRbsIgnoresParentConfig(t *testing.T) {
+	parent := t.TempDir()
+	if err := os.Mkdir(filepath.Join(parent, ".ti-config"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(parent, "app")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	path := filepath.Join(dir, "foo.rbs")
+	if err := os.WriteFile(path, []byte("class Foo\n  def bar: () -> String\nend\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := ImportRbs([]string{path}); status != 0 {
+		t.Errorf("status = %d, want 0", status)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ".ti-config", "foo.json")); err != nil {
+		t.Errorf("foo.json not written below the working directory: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(parent, ".ti-config", "foo.json")); err == nil {
+		t.Errorf("foo.json written into the parent project")
+	}
+}
+
+func importRbsText(t *testing.T, content string) []TiClassConfig {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "sig.rbs")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	classConfigs, issues := importRbsFiles([]string{path})
+	for _, issue := range issues {
+		t.Errorf("unexpected issue: %s", issue)
+	}
+
+	return classConfigs
+}
+
+func TestRbsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		rbs    string
+		header []string
+	}{
+		{
+			name: "class with superclass and mixin",
+			rbs: `module Greeter
+  def greet: (String) -> String
+end
+
+class Person < Base
+  include Greeter
+
+  def initialize: (String name) -> void
+  def name: () -> String
+end
+`,
+			header: []string{"module Greeter", "class Person < Base", "  include Greeter"},
+		},
+		{
+			name: "mixin only",
+			rbs: `class Report
+  include Comparable
+
+  def self.build: (?Integer) -> Report
+  def rows: (*String) { (Integer) -> untyped } -> Array[String]
+end
+`,
+			header: []string{"class Report", "  include Comparable"},
+		},
+		{
+			name: "constants and keywords",
+			rbs: `class Config
+  VERSION: String
+
+  # the value for key
+  def fetch: (key: Symbol, ?default: String?) -> (String | Integer)?
+end
+`,
+			header: []string{"class Config", "  VERSION: String", "  # the value for key"},
+		},
+		{
+			name: "block without parameters",
+			rbs: `class Runner
+  def run: () { () -> void } -> void
+  def call: () -> void
+end
+`,
+			header: []string{"class Runner"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scope := &workspaceScope{Root: t.TempDir()}
+
+			configDir := configDirPath(scope)
+			if err := os.MkdirAll(configDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			imported := importRbsText(t, test.rbs)
+
+			// go through the class files like import-rbs and export-rbs do
+			for _, classConfig := range imported {
+				if err := writeClassConfigFile(configDir, classConfig); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			exported := exportRbs(scope)
+
+			lines := strings.Split(exported, "\n")
+			for _, header := range test.header {
+				if !slices.Contains(lines, header) {
+					t.Errorf("export lacks %q:\n%s", header, exported)
+				}
+			}
+
+			reimported := importRbsText(t, exported)
+
+			byClass := func(a, b TiClassConfig) int { return strings.Compare(a.Class, b.Class) }
+			slices.SortFunc(imported, byClass)
+			slices.SortFunc(reimported, byClass)
+
+			if !reflect.DeepEqual(reimported, imported) {
+				t.Errorf("round trip changed the configs\nexported:\n%s\ngot  %+v\nwant %+v", exported, reimported, imported)
+			}
+		})
+	}
+}
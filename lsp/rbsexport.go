@@ -0,0 +1,358 @@
+package lsp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// ti types rendered as a different RBS type
+var tiRbsTypeNames = map[string]string{
+	"Int":         "Integer",
+	"Bool":        "bool",
+	"NilClass":    "nil",
+	"Untyped":     "untyped",
+	"Self":        "self",
+	"Number":      "Numeric",
+	"Block":       "Proc",
+	"Array":       "Array[untyped]",
+	"Hash":        "Hash[untyped, untyped]",
+	"Range":       "Range[untyped]",
+	"IntArray":    "Array[Integer]",
+	"FloatArray":  "Array[Float]",
+	"StringArray": "Array[String]",
+}
+
+// ti's special types with no RBS counterpart
+var tiUntypedNames = []string{
+	"Unify", "OptionalUnify", "SelfArray", "Argument", "UnifyArgument",
+	"Flatten", "Union", "Keyword", "IntInt", "BlockResultArray",
+	"KeyValueArray", "KeyArray",
+}
+
+const defaultRbsExportPath = "sig/ti-config.rbs"
+
+func formatRbsTypeName(typeName string) string {
+	if rbsType, ok := tiRbsTypeNames[typeName]; ok {
+		return rbsType
+	}
+
+	if slices.Contains(tiUntypedNames, typeName) {
+		return "untyped"
+	}
+
+	return typeName
+}
+
+// formatRbsType renders a ti type union, optional when nil is allowed
+func formatRbsType(types []string, isOptional bool) string {
+	var names []string
+
+	for _, typeName := range types {
+		if typeName == "NilClass" && isOptional {
+			continue
+		}
+
+		names = appendUnique(names, formatRbsTypeName(typeName))
+	}
+
+	if len(names) == 0 {
+		names = []string{"untyped"}
+	}
+
+	rbsType := strings.Join(names, " | ")
+
+	if isOptional && rbsType != "untyped" {
+		if len(names) > 1 {
+			rbsType = "(" + rbsType + ")"
+		}
+
+		rbsType += "?"
+	}
+
+	return rbsType
+}
+
+func formatRbsArgument(argument TiArgument) string {
+	types := argument.Type
+	prefix := ""
+
+	// ti marks positional arguments with a default by a Default type
+	if len(types) == 1 && strings.HasPrefix(types[0], "Default") {
+		types = []string{strings.TrimPrefix(types[0], "Default")}
+		prefix = "?"
+	}
+
+	isOptional := slices.Contains(types, "NilClass") && len(types) > 1
+
+	rbsType := formatRbsType(types, isOptional)
+	if len(types) > 1 && !isOptional {
+		rbsType = "(" + rbsType + ")"
+	}
+
+	switch {
+	case argument.Key != "":
+		return prefix + argument.Key + ": " + rbsType
+	case argument.IsAsterisk:
+		return "*" + rbsType
+	default:
+		return prefix + rbsType
+	}
+}
+
+// formatRbsMethod renders a TiMethod as an RBS def
+func formatRbsMethod(method TiMethod, isClassMethod bool, indent string) string {
+	var builder strings.Builder
+
+	if method.Document != "" {
+		for _, line := range strings.Split(strings.TrimRight(method.Document, "\n"), "\n") {
+			fmt.Fprintf(&builder, "%s# %s\n", indent, line)
+		}
+	}
+
+	var arguments []string
+	for _, argument := range method.Arguments {
+		arguments = append(arguments, formatRbsArgument(argument))
+	}
+
+	name := method.Name
+	returnType := formatRbsType(method.ReturnType.Type, method.ReturnType.IsConditional)
+
+	switch {
+	case isClassMethod && name == "new":
+		// ti models construction as the class method new
+		name = "initialize"
+		returnType = "void"
+	case isClassMethod:
+		name = "self." + name
+	}
+
+	fmt.Fprintf(&builder, "%sdef %s: (%s)", indent, name, strings.Join(arguments, ", "))
+
+	if method.BlockParameters != nil {
+		var params []string
+		for _, param := range method.BlockParameters {
+			params = append(params, formatRbsTypeName(param))
+		}
+
+		fmt.Fprintf(&builder, " { (%s) -> untyped }", strings.Join(params, ", "))
+	}
+
+	fmt.Fprintf(&builder, " -> %s\n", returnType)
+
+	return builder.String()
+}
+
+// rbsCoreModules are the Ruby core modules configs commonly mix in
+var rbsCoreModules = []string{
+	"Kernel", "Comparable", "Enumerable", "Math", "Process", "Marshal",
+	"ObjectSpace", "GC", "Signal", "FileTest", "Errno", "Warning",
+}
+
+// isRbsModule tells whether className is a module. ti does not record it,
+// so the ruby source decides, then whether the class can be created with
+// new, then whether another config mixes it in
+func isRbsModule(scope *workspaceScope, className string, classConfigs []TiClassConfig) bool {
+	if bodies := findRubyClassBodies(scope, "", className); len(bodies) > 0 {
+		return !slices.ContainsFunc(bodies, func(body RubyClassLocation) bool {
+			return !body.IsModule
+		})
+	}
+
+	if slices.Contains(rbsCoreModules, className) {
+		return true
+	}
+
+	for _, classConfig := range classConfigs {
+		if classConfig.Class != className {
+			continue
+		}
+
+		if slices.ContainsFunc(classConfig.ClassMethods, func(method TiMethod) bool {
+			return method.Name == "new"
+		}) {
+			return false
+		}
+	}
+
+	for _, classConfig := range classConfigs {
+		if len(classConfig.Extends) > 1 && slices.Contains(classConfig.Extends[1:], className) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// formatRbsClass renders a class or module config. ti keeps superclasses
+// and mixins together in extends, a leading class is the superclass and
+// the rest are included
+func formatRbsClass(scope *workspaceScope, classConfig TiClassConfig, classConfigs []TiClassConfig) string {
+	var builder strings.Builder
+
+	isModule := isRbsModule(scope, classConfig.Class, classConfigs)
+	mixins := classConfig.Extends
+
+	if isModule {
+		fmt.Fprintf(&builder, "module %s\n", classConfig.Class)
+	} else {
+		fmt.Fprintf(&builder, "class %s", classConfig.Class)
+
+		if len(mixins) > 0 && !isRbsModule(scope, mixins[0], classConfigs) {
+			fmt.Fprintf(&builder, " < %s", mixins[0])
+			mixins = mixins[1:]
+		}
+
+		builder.WriteString("\n")
+	}
+
+	if len(mixins) > 0 {
+		for _, module := range mixins {
+			fmt.Fprintf(&builder, "  include %s\n", module)
+		}
+
+		builder.WriteString("\n")
+	}
+
+	for _, constant := range classConfig.Constants {
+		fmt.Fprintf(
+			&builder,
+			"  %s: %s\n",
+			constant.Name,
+			formatRbsType(constant.ReturnType.Type, constant.ReturnType.IsConditional),
+		)
+	}
+
+	if len(classConfig.Constants) > 0 {
+		builder.WriteString("\n")
+	}
+
+	for _, method := range classConfig.ClassMethods {
+		builder.WriteString(formatRbsMethod(method, true, "  "))
+	}
+
+	for _, method := range classConfig.InstanceMethods {
+		builder.WriteString(formatRbsMethod(method, false, "  "))
+	}
+
+	builder.WriteString("end\n")
+
+	return builder.String()
+}
+
+// exportRbs renders every .ti-config class into one RBS document
+func exportRbs(scope *workspaceScope) string {
+	classConfigs := loadClassConfigs(scope)
+
+	var classNames []string
+	for _, classConfig := range classConfigs {
+		classNames = append(classNames, classConfig.Class)
+	}
+
+	var sections []string
+	var namespaces []string
+
+	for _, classConfig := range classConfigs {
+		// RBS needs the namespace of Foo::Bar declared on its own
+		_, parent := splitNamespace(classConfig.Class)
+		for parent != "" {
+			if !slices.Contains(classNames, parent) && !slices.Contains(namespaces, parent) {
+				namespaces = append(namespaces, parent)
+			}
+
+			_, parent = splitNamespace(parent)
+		}
+	}
+
+	slices.Sort(namespaces)
+
+	for _, namespace := range namespaces {
+		sections = append(sections, fmt.Sprintf("module %s\nend\n", namespace))
+	}
+
+	for _, classConfig := range classConfigs {
+		sections = append(sections, formatRbsClass(scope, classConfig, classConfigs))
+	}
+
+	return "# Generated from .ti-config by ti-lsp\n\n" + strings.Join(sections, "\n")
+}
+
+// makeRbsExportEdit writes the exported RBS to path, replacing what is there
+func makeRbsExportEdit(scope *workspaceScope, path string) protocol.WorkspaceEdit {
+	fileUri := protocol.DocumentUri("file://" + path)
+
+	return protocol.WorkspaceEdit{
+		DocumentChanges: []any{
+			protocol.CreateFile{
+				Kind: "create",
+				URI:  fileUri,
+				Options: &protocol.CreateFileOptions{
+					Overwrite: &[]bool{true}[0],
+				},
+			},
+			protocol.TextDocumentEdit{
+				TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+					TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: fileUri},
+				},
+				Edits: []any{
+					protocol.TextEdit{
+						Range: protocol.Range{
+							Start: protocol.Position{Line: 0, Character: 0},
+							End:   protocol.Position{Line: 0, Character: 0},
+						},
+						NewText: exportRbs(scope),
+					},
+				},
+			},
+		},
+	}
+}
+
+// resolveRbsExportPath places a relative output path under the workspace
+func resolveRbsExportPath(scope *workspaceScope, path string) string {
+	if path == "" {
+		path = defaultRbsExportPath
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(scope.Root, path)
+	}
+
+	return path
+}
+
+// ExportRbs is the export-rbs subcommand: it writes every .ti-config class
+// into one .rbs file
+func ExportRbs(args []string) int {
+	scope := findDefaultScope()
+
+	if findBuiltinConfigDir(scope) == "" {
+		fmt.Fprintln(os.Stderr, ".ti-config directory not found")
+		return 1
+	}
+
+	path := ""
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	path = resolveRbsExportPath(scope, path)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err := os.WriteFile(path, []byte(exportRbs(scope)), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("exported %s\n", path)
+
+	return 0
+}
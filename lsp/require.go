@@ -0,0 +1,336 @@
+package lsp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+var (
+	requirePattern = regexp.MustCompile(`^\s*(require|require_relative)\s*\(?\s*["']([^"']*)["']`)
+
+	requirePrefixPattern = regexp.MustCompile(`^\s*(require|require_relative)\s*\(?\s*["']([^"']*)$`)
+)
+
+var knownLibraries = []string{
+	"base64", "benchmark", "bigdecimal", "csv", "date", "digest", "English",
+	"erb", "fileutils", "forwardable", "io/console", "ipaddr", "json",
+	"logger", "net/http", "observer", "open3", "open-uri", "optparse",
+	"ostruct", "pathname", "pp", "prettyprint", "securerandom", "set",
+	"shellwords", "singleton", "socket", "stringio", "strscan", "tempfile",
+	"time", "timeout", "tmpdir", "uri", "yaml", "zlib",
+}
+
+var skipDirs = []string{"node_modules", "vendor", "tmp", "log"}
+
+// RequireInfo is a require / require_relative statement in the document,
+// Start and End are the UTF-16 columns of the path
+type RequireInfo struct {
+	Kind  string
+	Path  string
+	Line  uint32
+	Start uint32
+	End   uint32
+}
+
+func findRequires(content string) []RequireInfo {
+	var requires []RequireInfo
+
+	for i, line := range strings.Split(content, "\n") {
+		loc := requirePattern.FindStringSubmatchIndex(line)
+		if loc == nil {
+			continue
+		}
+
+		requires = append(requires, RequireInfo{
+			Kind:  line[loc[2]:loc[3]],
+			Path:  line[loc[4]:loc[5]],
+			Line:  uint32(i),
+			Start: offsetToPosition(line, loc[4]).Character,
+			End:   offsetToPosition(line, loc[5]).Character,
+		})
+	}
+
+	return requires
+}
+
+// resolveRequirePath returns the file a require points to, or ""
+func resolveRequirePath(scope *workspaceScope, documentPath string, require RequireInfo) string {
+	fileName := require.Path
+	if !strings.HasSuffix(fileName, ".rb") {
+		fileName += ".rb"
+	}
+
+	var candidates []string
+
+	switch require.Kind {
+	case "require_relative":
+		candidates = append(candidates, filepath.Join(filepath.Dir(documentPath), fileName))
+
+	default:
+		root := scope.Root
+		candidates = append(
+			candidates,
+			filepath.Join(root, "lib", fileName),
+			filepath.Join(root, fileName),
+		)
+	}
+
+	for _, candidate := range candidates {
+		if stat, err := os.Stat(candidate); err == nil && !stat.IsDir() {
+			return candidate
+		}
+	}
+
+	return ""
+}
+
+func isRequireString(content string, line uint32, character uint32) bool {
+	lines := strings.Split(content, "\n")
+	if int(line) >= len(lines) {
+		return false
+	}
+
+	currentLine := lines[line]
+	if int(character) < len(currentLine) {
+		currentLine = currentLine[:character]
+	}
+
+	return requirePrefixPattern.MatchString(currentLine)
+}
+
+// listRequireEntries lists sub directories and ruby files in dir
+func listRequireEntries(dir string) []Sig {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return []Sig{}
+	}
+
+	var signatures []Sig
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		if entry.IsDir() {
+			if slices.Contains(skipDirs, name) {
+				continue
+			}
+
+			signatures = append(signatures, Sig{
+				Method: name + "/",
+				Detail: filepath.Join(dir, name),
+				Kind:   protocol.CompletionItemKindFolder,
+			})
+
+			continue
+		}
+
+		if !strings.HasSuffix(name, ".rb") {
+			continue
+		}
+
+		signatures = append(signatures, Sig{
+			Method: strings.TrimSuffix(name, ".rb"),
+			Detail: filepath.Join(dir, name),
+			Kind:   protocol.CompletionItemKindFile,
+		})
+	}
+
+	return signatures
+}
+
+// findRequireCompletion completes the last path segment of a require string
+func findRequireCompletion(
+	scope *workspaceScope,
+	uri protocol.DocumentUri,
+	content string,
+	line uint32,
+	character uint32,
+) []Sig {
+
+	lines := strings.Split(content, "\n")
+	currentLine := lines[line]
+	if int(character) < len(currentLine) {
+		currentLine = currentLine[:character]
+	}
+
+	matches := requirePrefixPattern.FindStringSubmatch(currentLine)
+	if matches == nil {
+		return []Sig{}
+	}
+
+	typedDir := ""
+	if idx := strings.LastIndex(matches[2], "/"); idx != -1 {
+		typedDir = matches[2][:idx]
+	}
+
+	if matches[1] == "require_relative" {
+		documentDir := filepath.Dir(uriToPath(uri))
+		return listRequireEntries(filepath.Join(documentDir, typedDir))
+	}
+
+	root := scope.Root
+
+	var signatures []Sig
+	seen := make(map[string]bool)
+
+	for _, dir := range []string{filepath.Join(root, "lib", typedDir), filepath.Join(root, typedDir)} {
+		for _, sig := range listRequireEntries(dir) {
+			if seen[sig.Method] {
+				continue
+			}
+
+			seen[sig.Method] = true
+			signatures = append(signatures, sig)
+		}
+	}
+
+	for _, library := range knownLibraries {
+		name, ok := strings.CutPrefix(library, typedDir)
+		if typedDir != "" {
+			name, ok = strings.CutPrefix(name, "/")
+		}
+
+		if !ok || name == "" || strings.Contains(name, "/") || seen[name] {
+			continue
+		}
+
+		seen[name] = true
+
+		signatures = append(signatures, Sig{
+			Method: name,
+			Detail: "library",
+			Kind:   protocol.CompletionItemKindModule,
+		})
+	}
+
+	return signatures
+}
+
+func findRequireDiagnostics(scope *workspaceScope, uri protocol.DocumentUri, content string) []protocol.Diagnostic {
+	documentPath := uriToPath(uri)
+
+	var diagnostics []protocol.Diagnostic
+
+	for _, require := range findRequires(content) {
+		// a plain require may load any installed gem, only relative
+		// requires are known to be broken
+		if require.Kind != "require_relative" {
+			continue
+		}
+
+		if resolveRequirePath(scope, documentPath, require) != "" {
+			continue
+		}
+
+		severity := protocol.DiagnosticSeverityWarning
+
+		diagnostics = append(diagnostics, protocol.Diagnostic{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: require.Line, Character: require.Start},
+				End:   protocol.Position{Line: require.Line, Character: require.End},
+			},
+			Severity: &severity,
+			Source:   &[]string{"ruby-ti"}[0],
+			Message:  fmt.Sprintf("cannot resolve %s '%s'", require.Kind, require.Path),
+		})
+	}
+
+	return diagnostics
+}
+
+func textDocumentDocumentLink(
+	ctx *glsp.Context,
+	params *protocol.DocumentLinkParams,
+) ([]protocol.DocumentLink, error) {
+
+	scope := findDocumentScope(params.TextDocument.URI)
+
+	if !getSettings(scope).Features.DocumentLinks {
+		return nil, nil
+	}
+
+	content, ok := getOpenDocument(params.TextDocument.URI)
+	if !ok {
+		return nil, nil
+	}
+
+	documentPath := uriToPath(params.TextDocument.URI)
+
+	var links []protocol.DocumentLink
+
+	for _, require := range findRequires(content) {
+		targetPath := resolveRequirePath(scope, documentPath, require)
+		if targetPath == "" {
+			continue
+		}
+
+		target := protocol.DocumentUri("file://" + targetPath)
+
+		links = append(links, protocol.DocumentLink{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: require.Line, Character: require.Start},
+				End:   protocol.Position{Line: require.Line, Character: require.End},
+			},
+			Target: &target,
+		})
+	}
+
+	return links, nil
+}
+
+// findWorkspaceRubyFiles lists every ruby file under the root of scope
+func findWorkspaceRubyFiles(scope *workspaceScope) []string {
+	var paths []string
+
+	root := scope.Root
+
+	filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		name := entry.Name()
+
+		if entry.IsDir() {
+			if path != root &&
+				(strings.HasPrefix(name, ".") || slices.Contains(skipDirs, name)) {
+
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if strings.HasSuffix(name, ".rb") {
+			paths = append(paths, path)
+		}
+
+		return nil
+	})
+
+	return paths
+}
+
+// readWorkspaceFile prefers the open buffer over the file on disk
+func readWorkspaceFile(path string) string {
+	if content, ok := getOpenDocument("file://" + path); ok {
+		return content
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
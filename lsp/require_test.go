@@ -0,0 +1,27 @@
+package lsp
+
+import "testing"
+
+func TestFindRequiresColumns(t *testing.T) {
+	tests := []struct {
+		content string
+		start   uint32
+		end     uint32
+	}{
+		{"require 'foo'", 9, 12},
+		{"require_relative \"lib/bar\"", 18, 25},
+		{"require 'é/foo'", 9, 14},
+		{"require '😀/foo'", 9, 15},
+	}
+
+	for _, test := range tests {
+		requires := findRequires(test.content)
+		if len(requires) != 1 {
+			t.Fatalf("findRequires(%q) found %d requires, want 1", test.content, len(requires))
+		}
+
+		if requires[0].Start != test.start || requires[0].End != test.end {
+			t.Errorf("findRequires(%q) = %d-%d, want %d-%d", test.content, requires[0].Start, requires[0].End, test.start, test.end)
+		}
+	}
+}
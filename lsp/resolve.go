@@ -0,0 +1,118 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const completionCacheTTL = 30 * time.Second
+
+type completionCacheEntry struct {
+	Sig       Sig
+	ExpiresAt time.Time
+}
+
+var completionCache = make(map[string]completionCacheEntry)
+var completionCacheMutex sync.Mutex
+
+// makeCompletionCacheKey keys an item by its index in the list, labels
+// repeat when a local and a method share a name
+func makeCompletionCacheKey(
+	uri protocol.DocumentUri,
+	position protocol.Position,
+	index int,
+	method string,
+) string {
+
+	return fmt.Sprintf("%s:%d:%d:%d:%s", uri, position.Line, position.Character, index, method)
+}
+
+// storeCompletionSigs drops expired entries and caches sigs of the new list
+func storeCompletionSigs(
+	uri protocol.DocumentUri,
+	position protocol.Position,
+	signatures []Sig,
+) []string {
+
+	completionCacheMutex.Lock()
+	defer completionCacheMutex.Unlock()
+
+	now := time.Now()
+
+	for key, entry := range completionCache {
+		if now.After(entry.ExpiresAt) {
+			delete(completionCache, key)
+		}
+	}
+
+	keys := make([]string, 0, len(signatures))
+
+	for i, sig := range signatures {
+		key := makeCompletionCacheKey(uri, position, i, sig.Method)
+
+		completionCache[key] = completionCacheEntry{
+			Sig:       sig,
+			ExpiresAt: now.Add(completionCacheTTL),
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func loadCompletionSig(key string) (Sig, bool) {
+	completionCacheMutex.Lock()
+	defer completionCacheMutex.Unlock()
+
+	entry, ok := completionCache[key]
+	if !ok || time.Now().After(entry.ExpiresAt) {
+		return Sig{}, false
+	}
+
+	return entry.Sig, true
+}
+
+func makeCompletionDocumentation(sig Sig) string {
+	var docParts []string
+
+	allSigs := []string{sig.Detail}
+	if len(sig.Overloads) > 0 {
+		allSigs = append(allSigs, sig.Overloads...)
+	}
+	docParts = append(docParts, "```ruby\n"+strings.Join(allSigs, "\n")+"\n```")
+
+	if sig.Documentation != "" {
+		docParts = append(docParts, sig.Documentation)
+	}
+
+	return strings.Join(docParts, "\n\n---\n\n")
+}
+
+func completionItemResolve(
+	ctx *glsp.Context,
+	params *protocol.CompletionItem,
+) (*protocol.CompletionItem, error) {
+
+	key, ok := params.Data.(string)
+	if !ok {
+		return params, nil
+	}
+
+	sig, ok := loadCompletionSig(key)
+	if !ok {
+		return params, nil
+	}
+
+	params.Documentation = protocol.MarkupContent{
+		Kind:  protocol.MarkupKindMarkdown,
+		Value: makeCompletionDocumentation(sig),
+	}
+
+	return params, nil
+}
@@ -0,0 +1,529 @@
+package lsp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+var identifierPattern = regexp.MustCompile(`^[a-z_]\w*$`)
+
+// deriveParamNames names parameters after the call site arguments
+// foo(name, 1, key: v, *rest, &blk) -> name, arg1, key:, *rest, &blk
+func deriveParamNames(call *CallSite) []string {
+	var params []string
+
+	seen := make(map[string]bool)
+
+	unique := func(name string) string {
+		base := name
+		for i := 1; seen[name]; i++ {
+			name = fmt.Sprintf("%s%d", base, i)
+		}
+
+		seen[name] = true
+
+		return name
+	}
+
+	hasBlock := call.HasBlock
+
+	for i, argument := range call.Arguments {
+		switch {
+		case strings.HasPrefix(argument, "&"):
+			hasBlock = true
+
+		case strings.HasPrefix(argument, "**"):
+			params = append(params, "**"+unique("options"))
+
+		case strings.HasPrefix(argument, "*"):
+			name := strings.TrimPrefix(argument, "*")
+			if !identifierPattern.MatchString(name) {
+				name = "args"
+			}
+
+			params = append(params, "*"+unique(name))
+
+		default:
+			if matches := keywordArgumentPattern.FindStringSubmatch(argument); matches != nil {
+				params = append(params, unique(matches[1])+":")
+				continue
+			}
+
+			name := argument
+			if idx := strings.LastIndex(name, "."); idx != -1 {
+				name = name[idx+1:]
+			}
+
+			name = strings.TrimLeft(name, "@$")
+
+			if !identifierPattern.MatchString(name) {
+				name = fmt.Sprintf("arg%d", i)
+			}
+
+			params = append(params, unique(name))
+		}
+	}
+
+	if hasBlock {
+		params = append(params, "&"+unique("block"))
+	}
+
+	return params
+}
+
+// RubyClassLocation is where a class or module body lives in a ruby file
+type RubyClassLocation struct {
+	Name     string
+	IsModule bool
+	Path     string
+	Line     int
+	EndLine  int
+	Indent   string
+}
+
+// rubyClassIndexEntry is the classes of one workspace file, kept until the
+// file changes
+type rubyClassIndexEntry struct {
+	IsOpen    bool
+	Content   string
+	ModTime   time.Time
+	Size      int64
+	Locations []RubyClassLocation
+}
+
+var rubyClassIndex = make(map[string]rubyClassIndexEntry)
+var rubyClassIndexMutex sync.Mutex
+
+// indexRubyFile returns the closed class and module bodies in path,
+// parsing the file again only when it was edited or changed on disk
+func indexRubyFile(path string) []RubyClassLocation {
+	content, isOpen := getOpenDocument("file://" + path)
+
+	var modTime time.Time
+	var size int64
+
+	if !isOpen {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil
+		}
+
+		modTime, size = stat.ModTime(), stat.Size()
+	}
+
+	rubyClassIndexMutex.Lock()
+	entry, ok := rubyClassIndex[path]
+	rubyClassIndexMutex.Unlock()
+
+	if ok && entry.IsOpen == isOpen {
+		if isOpen && entry.Content == content ||
+			!isOpen && entry.ModTime.Equal(modTime) && entry.Size == size {
+
+			return entry.Locations
+		}
+	}
+
+	if !isOpen {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+
+		content = string(data)
+	}
+
+	entry = rubyClassIndexEntry{
+		IsOpen:  isOpen,
+		ModTime: modTime,
+		Size:    size,
+	}
+
+	// only open documents are compared by content
+	if isOpen {
+		entry.Content = content
+	}
+
+	lines := strings.Split(content, "\n")
+
+	for _, definition := range findRubyClassDefinitions(content) {
+		if definition.EndLine == -1 {
+			continue
+		}
+
+		entry.Locations = append(entry.Locations, RubyClassLocation{
+			Name:     definition.Name,
+			IsModule: definition.IsModule,
+			Path:     path,
+			Line:     definition.Line,
+			EndLine:  definition.EndLine,
+			Indent:   lineIndent(lines[definition.Line], 0),
+		})
+	}
+
+	rubyClassIndexMutex.Lock()
+	rubyClassIndex[path] = entry
+	rubyClassIndexMutex.Unlock()
+
+	return entry.Locations
+}
+
+// findRubyClassBodies lists the bodies of className in the workspace by its
+// whole namespace path, those in currentPath first since the document may
+// not be saved yet
+func findRubyClassBodies(scope *workspaceScope, currentPath string, className string) []RubyClassLocation {
+	className = strings.TrimPrefix(className, "::")
+
+	var paths []string
+	if currentPath != "" {
+		paths = append(paths, currentPath)
+	}
+
+	for _, path := range findWorkspaceRubyFiles(scope) {
+		if path != currentPath {
+			paths = append(paths, path)
+		}
+	}
+
+	var bodies []RubyClassLocation
+
+	for _, path := range paths {
+		for _, location := range indexRubyFile(path) {
+			if location.Name == className {
+				bodies = append(bodies, location)
+			}
+		}
+	}
+
+	return bodies
+}
+
+func findRubyClassBody(scope *workspaceScope, uri protocol.DocumentUri, className string) *RubyClassLocation {
+	for _, body := range findRubyClassBodies(scope, uriToPath(uri), className) {
+		if !body.IsModule {
+			return &body
+		}
+	}
+
+	return nil
+}
+
+// createRubyMethodCodeAction inserts a def into the ruby class body
+func createRubyMethodCodeAction(
+	scope *workspaceScope,
+	uri protocol.DocumentUri,
+	errorInfo *ErrorInfo,
+	diagnostic protocol.Diagnostic,
+) *protocol.CodeAction {
+
+	// ti reads classes with a JSON definition from .ti-config, a def in the
+	// ruby source would not be seen
+	if findBuiltinJsonPath(scope, errorInfo.ClassName) != "" {
+		return nil
+	}
+
+	classBody := findRubyClassBody(scope, uri, errorInfo.ClassName)
+	if classBody == nil {
+		return nil
+	}
+
+	var params []string
+
+	lines := strings.Split(getDocumentContent(uri), "\n")
+	if int(errorInfo.Line) < len(lines) {
+		if call := findCallSite(lines[errorInfo.Line], errorInfo.MethodName); call != nil {
+			params = deriveParamNames(call)
+		}
+	}
+
+	methodName := errorInfo.MethodName
+	if errorInfo.MethodType == "class" {
+		methodName = "self." + methodName
+	}
+
+	signature := methodName
+	if len(params) > 0 {
+		signature += "(" + strings.Join(params, ", ") + ")"
+	}
+
+	indent := classBody.Indent + "  "
+
+	newText := fmt.Sprintf("%sdef %s\n%send\n", indent, signature, indent)
+	if classBody.EndLine-1 > classBody.Line {
+		newText = "\n" + newText
+	}
+
+	changes := make(map[protocol.DocumentUri][]protocol.TextEdit)
+	fileUri := protocol.DocumentUri("file://" + classBody.Path)
+
+	changes[fileUri] = []protocol.TextEdit{
+		{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: uint32(classBody.EndLine), Character: 0},
+				End:   protocol.Position{Line: uint32(classBody.EndLine), Character: 0},
+			},
+			NewText: newText,
+		},
+	}
+
+	edit := protocol.WorkspaceEdit{
+		Changes: changes,
+	}
+
+	kind := protocol.CodeActionKindQuickFix
+
+	return &protocol.CodeAction{
+		Title: fmt.Sprintf(
+			"Define method '%s' in class '%s'",
+			errorInfo.MethodName,
+			errorInfo.ClassName,
+		),
+		Kind:        &kind,
+		Diagnostics: []protocol.Diagnostic{diagnostic},
+		Edit:        &edit,
+	}
+}
+
+// toSnakeCase converts a constant name to its file name: BarBaz -> bar_baz,
+// HTTPServer -> http_server
+func toSnakeCase(name string) string {
+	var builder strings.Builder
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+
+		if c >= 'A' && c <= 'Z' {
+			if i > 0 && name[i-1] != '_' {
+				previousLower := name[i-1] >= 'a' && name[i-1] <= 'z' || name[i-1] >= '0' && name[i-1] <= '9'
+				nextLower := i+1 < len(name) && name[i+1] >= 'a' && name[i+1] <= 'z'
+
+				if previousLower || (nextLower && name[i-1] >= 'A' && name[i-1] <= 'Z') {
+					builder.WriteByte('_')
+				}
+			}
+
+			c += 'a' - 'A'
+		}
+
+		builder.WriteByte(c)
+	}
+
+	return builder.String()
+}
+
+// makeRubyClassPath places Foo::BarBaz according to the classPath setting
+func makeRubyClassPath(scope *workspaceScope, className string) string {
+	var segments []string
+	for _, segment := range strings.Split(className, "::") {
+		segments = append(segments, toSnakeCase(segment))
+	}
+
+	template := getSettings(scope).ClassPath
+	if template == "" {
+		template = "lib/{path}.rb"
+	}
+
+	path := strings.ReplaceAll(template, "{path}", strings.Join(segments, "/"))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(scope.Root, path)
+	}
+
+	return path
+}
+
+// isRubyClass reports whether namespace is already opened as a class
+// somewhere, reopening it as a module would raise TypeError
+func isRubyClass(scope *workspaceScope, namespace string) bool {
+	for _, body := range findRubyClassBodies(scope, "", namespace) {
+		if !body.IsModule {
+			return true
+		}
+	}
+
+	return false
+}
+
+// makeRubyClassSkeleton nests Foo::BarBaz inside its namespace modules
+func makeRubyClassSkeleton(scope *workspaceScope, className string) string {
+	segments := strings.Split(className, "::")
+
+	var builder strings.Builder
+
+	for i, segment := range segments {
+		keyword := "module"
+		if i == len(segments)-1 || isRubyClass(scope, strings.Join(segments[:i+1], "::")) {
+			keyword = "class"
+		}
+
+		fmt.Fprintf(&builder, "%s%s %s\n", strings.Repeat("  ", i), keyword, segment)
+	}
+
+	for i := len(segments) - 1; i >= 0; i-- {
+		fmt.Fprintf(&builder, "%send\n", strings.Repeat("  ", i))
+	}
+
+	return builder.String()
+}
+
+// findRequireInsertLine returns the line after the leading requires, or
+// after the magic comments when the file has no requires yet
+func findRequireInsertLine(content string) uint32 {
+	lines := strings.Split(content, "\n")
+
+	insertLine := uint32(0)
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case requirePattern.MatchString(line):
+			insertLine = uint32(i + 1)
+		case strings.HasPrefix(trimmed, "#") && insertLine == uint32(i):
+			insertLine = uint32(i + 1)
+		case trimmed == "":
+			continue
+		default:
+			return insertLine
+		}
+	}
+
+	return insertLine
+}
+
+// supportsCreateFile is set when the client applies documentChanges with
+// create file operations
+var supportsCreateFile bool
+
+func setCreateFileSupport(params *protocol.InitializeParams) {
+	workspace := params.Capabilities.Workspace
+	if workspace == nil || workspace.WorkspaceEdit == nil {
+		return
+	}
+
+	workspaceEdit := workspace.WorkspaceEdit
+
+	supportsCreateFile = workspaceEdit.DocumentChanges != nil && *workspaceEdit.DocumentChanges &&
+		slices.Contains(workspaceEdit.ResourceOperations, protocol.ResourceOperationKindCreate)
+}
+
+// createRubyClassCodeAction creates the class in a new ruby file and
+// requires it from the current document
+func createRubyClassCodeAction(
+	scope *workspaceScope,
+	uri protocol.DocumentUri,
+	errorInfo *ErrorInfo,
+	diagnostic protocol.Diagnostic,
+) *protocol.CodeAction {
+
+	if !supportsCreateFile {
+		return nil
+	}
+
+	className := errorInfo.ClassName
+	if className == "" || !unicode.IsUpper(rune(className[0])) {
+		return nil
+	}
+
+	classPath := makeRubyClassPath(scope, className)
+	if _, err := os.Stat(classPath); err == nil {
+		return nil
+	}
+
+	content := getDocumentContent(uri)
+	documentPath := uriToPath(uri)
+
+	requirePath, err := filepath.Rel(filepath.Dir(documentPath), classPath)
+	if err != nil {
+		return nil
+	}
+
+	requirePath = filepath.ToSlash(strings.TrimSuffix(requirePath, ".rb"))
+
+	classUri := protocol.DocumentUri("file://" + classPath)
+
+	documentChanges := []any{
+		protocol.CreateFile{
+			Kind: "create",
+			URI:  classUri,
+			Options: &protocol.CreateFileOptions{
+				IgnoreIfExists: &[]bool{true}[0],
+			},
+		},
+		protocol.TextDocumentEdit{
+			TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: classUri},
+			},
+			Edits: []any{
+				protocol.TextEdit{
+					Range: protocol.Range{
+						Start: protocol.Position{Line: 0, Character: 0},
+						End:   protocol.Position{Line: 0, Character: 0},
+					},
+					NewText: makeRubyClassSkeleton(scope, className),
+				},
+			},
+		},
+	}
+
+	alreadyRequired := false
+	for _, require := range findRequires(content) {
+		if resolveRequirePath(scope, documentPath, require) == classPath {
+			alreadyRequired = true
+		}
+	}
+
+	if !alreadyRequired {
+		insertLine := findRequireInsertLine(content)
+
+		newText := fmt.Sprintf("require_relative '%s'\n", requirePath)
+
+		// keep the new require apart from magic comments and code
+		if len(findRequires(content)) == 0 {
+			if insertLine > 0 {
+				newText = "\n" + newText
+			}
+
+			lines := strings.Split(content, "\n")
+			if int(insertLine) < len(lines) && strings.TrimSpace(lines[insertLine]) != "" {
+				newText += "\n"
+			}
+		}
+
+		documentChanges = append(documentChanges, protocol.TextDocumentEdit{
+			TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+			},
+			Edits: []any{
+				protocol.TextEdit{
+					Range: protocol.Range{
+						Start: protocol.Position{Line: insertLine, Character: 0},
+						End:   protocol.Position{Line: insertLine, Character: 0},
+					},
+					NewText: newText,
+				},
+			},
+		})
+	}
+
+	relativePath, err := filepath.Rel(scope.Root, classPath)
+	if err != nil {
+		relativePath = classPath
+	}
+
+	kind := protocol.CodeActionKindQuickFix
+
+	return &protocol.CodeAction{
+		Title:       fmt.Sprintf("Create class '%s' in %s", className, relativePath),
+		Kind:        &kind,
+		Diagnostics: []protocol.Diagnostic{diagnostic},
+		Edit:        &protocol.WorkspaceEdit{DocumentChanges: documentChanges},
+	}
+}
@@ -0,0 +1,27 @@
+package lsp
+
+import "testing"
+
+func TestToSnakeCase(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Foo", "foo"},
+		{"BarBaz", "bar_baz"},
+		{"HTTPServer", "http_server"},
+		{"HTTP", "http"},
+		{"OAuth2Client", "o_auth2_client"},
+		{"Base64", "base64"},
+		{"V2Api", "v2_api"},
+		{"Already_Snake", "already_snake"},
+		{"foo", "foo"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := toSnakeCase(test.name); got != test.want {
+			t.Errorf("toSnakeCase(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const createConfigAction = "Create .ti-config"
+
+// exampleClassConfig is written when there is no class to start from
+var exampleClassConfig = TiClassConfig{
+	Frame:   "Builtin",
+	Class:   "Example",
+	Extends: []string{},
+	InstanceMethods: []TiMethod{
+		{
+			Name:       "greet",
+			Arguments:  []TiArgument{{Type: []string{"String"}}},
+			ReturnType: TiReturnType{Type: []string{"String"}},
+		},
+	},
+	ClassMethods: []TiMethod{
+		{
+			Name:       "new",
+			Arguments:  []TiArgument{},
+			ReturnType: TiReturnType{Type: []string{"Example"}},
+		},
+	},
+	Constants: []TiConstantType{},
+}
+
+// scaffoldConfig creates the config directory of the current project with
+// a class file for every class in content, or an example class. Files are
+// written directly, a workspace edit cannot create the directory itself
+func scaffoldConfig(scope *workspaceScope, content string) ([]string, error) {
+	configDir := configDirPath(scope)
+	if _, err := os.Stat(configDir); err == nil {
+		return nil, fmt.Errorf("%s already exists", configDir)
+	}
+
+	var classConfigs []TiClassConfig
+	for _, definition := range findRubyClassDefinitions(content) {
+		classConfigs = append(classConfigs, makeClassConfig(scope, content, definition))
+	}
+
+	if len(classConfigs) == 0 {
+		classConfigs = append(classConfigs, exampleClassConfig)
+	}
+
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return nil, err
+	}
+
+	var paths []string
+
+	for _, classConfig := range classConfigs {
+		jsonData, err := json.MarshalIndent(classConfig, "", "  ")
+		if err != nil {
+			return paths, err
+		}
+
+		path := filepath.Join(configDir, strings.ToLower(classConfig.Class)+".json")
+		if err := os.WriteFile(path, append(jsonData, '\n'), 0644); err != nil {
+			return paths, err
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// createConfig scaffolds .ti-config for scope and reports the files it
+// wrote. Inferring the classes runs ti, so it is not called from the
+// connection's read loop
+func createConfig(ctx *glsp.Context, scope *workspaceScope, content string) {
+	paths, err := scaffoldConfig(scope, content)
+	if err != nil {
+		showMessage(ctx, protocol.MessageTypeError, "ruby-ti: "+err.Error())
+		return
+	}
+
+	showMessage(
+		ctx,
+		protocol.MessageTypeInfo,
+		fmt.Sprintf("ruby-ti: created %s with %d class file(s)", configDirPath(scope), len(paths)),
+	)
+
+	rerunDiagnostics(ctx, nil)
+}
+
+// createConfigCommand scaffolds .ti-config for the project of the given
+// document, or of the first workspace folder
+func createConfigCommand(ctx *glsp.Context, arguments []any) (any, error) {
+	content := ""
+	scope := findDefaultScope()
+
+	if uri, ok := argumentString(arguments, 0); ok {
+		content = readWorkspaceFile(uriToPath(uri))
+		scope = findDocumentScope(uri)
+	}
+
+	configDir := configDirPath(scope)
+	if _, err := os.Stat(configDir); err == nil {
+		return nil, fmt.Errorf("%s already exists", configDir)
+	}
+
+	go createConfig(ctx, scope, content)
+
+	return nil, nil
+}
+
+// promptCreateConfig explains that no config was found and offers to
+// scaffold one. It must not be called from the connection's read loop
+func promptCreateConfig(ctx *glsp.Context) {
+	var action *protocol.MessageActionItem
+
+	ctx.Call(
+		protocol.ServerWindowShowMessageRequest,
+		protocol.ShowMessageRequestParams{
+			Type: protocol.MessageTypeWarning,
+			Message: fmt.Sprintf(
+				"ruby-ti: no %s directory found in the workspace, only ti's built-in types are known",
+				getBaseSettings().ConfigDir,
+			),
+			Actions: []protocol.MessageActionItem{{Title: createConfigAction}},
+		},
+		&action,
+	)
+
+	if action == nil || action.Title != createConfigAction {
+		return
+	}
+
+	createConfig(ctx, findDefaultScope(), "")
+}
@@ -0,0 +1,484 @@
+package lsp
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// rubyScope is one level of class/module/def/block nesting
+type rubyScope struct {
+	Kind        string
+	Name        string
+	Locals      []string
+	Params      []string
+	BlockParams []string
+	Ivars       []string
+	Methods     []string
+}
+
+// RubyConstant is a constant, class or module found in the document
+type RubyConstant struct {
+	Name      string
+	Namespace string
+	IsModule  bool
+	IsClass   bool
+}
+
+// ScopeInfo is everything visible as a bare identifier at the cursor
+type ScopeInfo struct {
+	Locals      []string
+	Params      []string
+	BlockParams []string
+	Ivars       []string
+	Methods     []string
+	Constants   []RubyConstant
+	Namespace   string
+}
+
+var (
+	scopeKeywordPattern = regexp.MustCompile(`\b(class|module|def|do|if|unless|while|until|case|begin|for|end)\b`)
+
+	defPattern = regexp.MustCompile(`^def\s+(self\.)?([^\s(;=]+[=]?)\s*(\(([^)]*)\)|([^;=]*))?`)
+
+	endlessDefPattern = regexp.MustCompile(`^def\s+(self\.)?[^\s(;]+\s*(\([^)]*\))?\s*=[^=]`)
+
+	classPattern = regexp.MustCompile(`^(class|module)\s+([A-Z][\w:]*)`)
+
+	localAssignPattern = regexp.MustCompile(`(?:^|[^.@:$\w])([a-z_][a-zA-Z0-9_]*)\s*(?:\+|-|\*|/|\|\||&&)?=(?:[^=~>]|$)`)
+
+	multiAssignPattern = regexp.MustCompile(`^\s*(\*?[a-z_]\w*(?:\s*,\s*\*?[a-z_]\w*)+)\s*=[^=]`)
+
+	constantAssignPattern = regexp.MustCompile(`(?:^|[^.:\w])([A-Z]\w*)\s*=(?:[^=~>]|$)`)
+
+	blockParamPattern = regexp.MustCompile(`(?:\bdo|\{)\s*\|([^|]*)\|`)
+
+	ivarPattern = regexp.MustCompile(`@[a-zA-Z_]\w*`)
+
+	forPattern = regexp.MustCompile(`^for\s+([a-z_]\w*(?:\s*,\s*[a-z_]\w*)*)\s+in\b`)
+
+	rescuePattern = regexp.MustCompile(`^rescue\b.*=>\s*([a-z_]\w*)`)
+)
+
+var rubyKeywords = []string{
+	"BEGIN", "END", "__ENCODING__", "__FILE__", "__LINE__", "alias", "and",
+	"begin", "break", "case", "class", "def", "defined?", "do", "else",
+	"elsif", "end", "ensure", "false", "for", "if", "in", "module", "next",
+	"nil", "not", "or", "redo", "rescue", "retry", "return", "self", "super",
+	"then", "true", "undef", "unless", "until", "when", "while", "yield",
+}
+
+// stripRubyLine blanks out string literals and drops trailing comments
+// so that keyword scanning does not see their contents
+func stripRubyLine(line string) string {
+	var builder strings.Builder
+
+	var quote byte
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		if quote != 0 {
+			if c == '\\' && i+1 < len(line) {
+				builder.WriteString("  ")
+				i++
+				continue
+			}
+
+			if c == quote {
+				quote = 0
+				builder.WriteByte(c)
+				continue
+			}
+
+			builder.WriteByte(' ')
+			continue
+		}
+
+		switch c {
+		case '"', '\'', '`':
+			quote = c
+			builder.WriteByte(c)
+		case '#':
+			return builder.String()
+		default:
+			builder.WriteByte(c)
+		}
+	}
+
+	return builder.String()
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		if value == "" || slices.Contains(list, value) {
+			continue
+		}
+
+		list = append(list, value)
+	}
+
+	return list
+}
+
+// def foo(a, b = 1, *rest, key:, &blk) -> a, b, rest, key, blk
+func parseParamNames(params string) []string {
+	var names []string
+
+	depth := 0
+	start := 0
+
+	split := func(end int) {
+		param := strings.TrimSpace(params[start:end])
+		param = strings.TrimLeft(param, "*&(")
+
+		if idx := strings.IndexAny(param, ":= )"); idx != -1 {
+			param = param[:idx]
+		}
+
+		if param != "" {
+			names = append(names, param)
+		}
+	}
+
+	for i := 0; i < len(params); i++ {
+		switch params[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				split(i)
+				start = i + 1
+			}
+		}
+	}
+
+	split(len(params))
+
+	return names
+}
+
+func isStatementStart(before string) bool {
+	before = strings.TrimSpace(before)
+	if before == "" {
+		return true
+	}
+
+	last := before[len(before)-1]
+
+	return strings.ContainsRune("=(,[|&!;", rune(last)) ||
+		strings.HasSuffix(before, "return") ||
+		strings.HasSuffix(before, "then")
+}
+
+func currentNamespace(stack []*rubyScope) string {
+	var names []string
+
+	for _, scope := range stack {
+		if scope.Kind == "class" || scope.Kind == "module" {
+			names = append(names, scope.Name)
+		}
+	}
+
+	return strings.Join(names, "::")
+}
+
+func innermostClass(stack []*rubyScope) *rubyScope {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].Kind == "class" || stack[i].Kind == "module" {
+			return stack[i]
+		}
+	}
+
+	return stack[0]
+}
+
+func isInSingletonClass(stack []*rubyScope) bool {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch stack[i].Kind {
+		case "sclass":
+			return true
+		case "class", "module":
+			return false
+		}
+	}
+
+	return false
+}
+
+func innermostLocalScope(stack []*rubyScope) *rubyScope {
+	return stack[len(stack)-1]
+}
+
+// scanRubyLine updates the scope stack with one line of source
+func scanRubyLine(
+	stack []*rubyScope,
+	line string,
+	constants *[]RubyConstant,
+) []*rubyScope {
+
+	code := strings.TrimSpace(stripRubyLine(line))
+	if code == "" {
+		return stack
+	}
+
+	for statement := range strings.SplitSeq(code, ";") {
+		stack = scanRubyStatement(stack, strings.TrimSpace(statement), constants)
+	}
+
+	return stack
+}
+
+func scanRubyStatement(
+	stack []*rubyScope,
+	code string,
+	constants *[]RubyConstant,
+) []*rubyScope {
+
+	if code == "" {
+		return stack
+	}
+
+	local := innermostLocalScope(stack)
+
+	if matches := multiAssignPattern.FindStringSubmatch(code); matches != nil {
+		for name := range strings.SplitSeq(matches[1], ",") {
+			name = strings.TrimLeft(strings.TrimSpace(name), "*")
+			local.Locals = appendUnique(local.Locals, name)
+		}
+	}
+
+	if !strings.HasPrefix(code, "def ") {
+		for _, matches := range localAssignPattern.FindAllStringSubmatch(code, -1) {
+			local.Locals = appendUnique(local.Locals, matches[1])
+		}
+	}
+
+	if matches := forPattern.FindStringSubmatch(code); matches != nil {
+		local.Locals = appendUnique(local.Locals, parseParamNames(matches[1])...)
+	}
+
+	if matches := rescuePattern.FindStringSubmatch(code); matches != nil {
+		local.Locals = appendUnique(local.Locals, matches[1])
+	}
+
+	for _, matches := range constantAssignPattern.FindAllStringSubmatch(code, -1) {
+		*constants = append(*constants, RubyConstant{
+			Name:      matches[1],
+			Namespace: currentNamespace(stack),
+		})
+	}
+
+	class := innermostClass(stack)
+	class.Ivars = appendUnique(class.Ivars, ivarPattern.FindAllString(code, -1)...)
+
+	if matches := classPattern.FindStringSubmatch(code); matches != nil {
+		namespace := currentNamespace(stack)
+		name := matches[2]
+
+		if idx := strings.LastIndex(name, "::"); idx != -1 {
+			if namespace != "" {
+				namespace += "::"
+			}
+			namespace += name[:idx]
+			name = name[idx+2:]
+		}
+
+		*constants = append(*constants, RubyConstant{
+			Name:      name,
+			Namespace: namespace,
+			IsModule:  matches[1] == "module",
+			IsClass:   matches[1] == "class",
+		})
+	}
+
+	blockParams := blockParamPattern.FindAllStringSubmatch(code, -1)
+
+	isLoopLine := false
+
+	for _, loc := range scopeKeywordPattern.FindAllStringSubmatchIndex(code, -1) {
+		keyword := code[loc[2]:loc[3]]
+		before := code[:loc[2]]
+		after := code[loc[3]:]
+
+		if strings.HasSuffix(before, ".") ||
+			strings.HasSuffix(before, ":") ||
+			strings.HasPrefix(after, ":") && !strings.HasPrefix(after, "::") {
+			continue
+		}
+
+		switch keyword {
+		case "end":
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+
+		case "class", "module":
+			if strings.TrimSpace(before) != "" {
+				continue
+			}
+
+			if matches := classPattern.FindStringSubmatch(code[loc[2]:]); matches != nil {
+				stack = append(stack, &rubyScope{Kind: keyword, Name: matches[2]})
+				continue
+			}
+
+			// class << self
+			stack = append(stack, &rubyScope{Kind: "sclass"})
+
+		case "def":
+			defCode := code[loc[2]:]
+
+			matches := defPattern.FindStringSubmatch(defCode)
+			if matches == nil {
+				continue
+			}
+
+			if matches[1] == "" && !isInSingletonClass(stack) {
+				owner := innermostClass(stack)
+				owner.Methods = appendUnique(owner.Methods, matches[2])
+			}
+
+			if endlessDefPattern.MatchString(defCode) {
+				continue
+			}
+
+			params := matches[4]
+			if params == "" {
+				params = matches[5]
+			}
+
+			stack = append(stack, &rubyScope{
+				Kind:   "def",
+				Name:   matches[2],
+				Params: parseParamNames(params),
+			})
+
+		case "do":
+			if isLoopLine {
+				continue
+			}
+
+			scope := &rubyScope{Kind: "block"}
+
+			if len(blockParams) > 0 {
+				scope.BlockParams = parseParamNames(blockParams[0][1])
+				blockParams = blockParams[1:]
+			}
+
+			stack = append(stack, scope)
+
+		case "while", "until", "for":
+			if !isStatementStart(before) {
+				continue
+			}
+
+			isLoopLine = true
+			stack = append(stack, &rubyScope{Kind: "other"})
+
+		default:
+			if !isStatementStart(before) {
+				continue
+			}
+
+			stack = append(stack, &rubyScope{Kind: "other"})
+		}
+	}
+
+	// brace blocks are not tracked as scopes, so their params stay
+	// visible in the enclosing scope
+	for _, matches := range blockParams {
+		local := innermostLocalScope(stack)
+		local.BlockParams = appendUnique(local.BlockParams, parseParamNames(matches[1])...)
+	}
+
+	return stack
+}
+
+// findScopeInfo collects identifiers visible at the given position
+func findScopeInfo(content string, line uint32, character uint32) ScopeInfo {
+	lines := strings.Split(content, "\n")
+
+	stack := []*rubyScope{{Kind: "top"}}
+
+	var constants []RubyConstant
+	var snapshot []rubyScope
+	var snapshotClass *rubyScope
+	var info ScopeInfo
+
+	for i, text := range lines {
+		if i == int(line) {
+			if int(character) <= len(text) {
+				text = text[:character]
+			}
+
+			stack = scanRubyLine(stack, text, &constants)
+
+			for _, scope := range stack {
+				copied := *scope
+				copied.Locals = slices.Clone(scope.Locals)
+				copied.BlockParams = slices.Clone(scope.BlockParams)
+				snapshot = append(snapshot, copied)
+			}
+
+			snapshotClass = innermostClass(stack)
+			info.Namespace = currentNamespace(stack)
+
+			continue
+		}
+
+		stack = scanRubyLine(stack, text, &constants)
+	}
+
+	if snapshot == nil {
+		return info
+	}
+
+	// locals are visible through blocks up to the nearest def/class
+	for i := len(snapshot) - 1; i >= 0; i-- {
+		scope := snapshot[i]
+
+		info.Locals = appendUnique(info.Locals, scope.Locals...)
+		info.Params = appendUnique(info.Params, scope.Params...)
+		info.BlockParams = appendUnique(info.BlockParams, scope.BlockParams...)
+
+		if scope.Kind != "block" && scope.Kind != "other" {
+			break
+		}
+	}
+
+	info.Ivars = snapshotClass.Ivars
+	info.Methods = snapshotClass.Methods
+
+	if snapshotClass.Kind != "top" {
+		info.Methods = appendUnique(info.Methods, stack[0].Methods...)
+	}
+
+	info.Constants = constants
+
+	return info
+}
+
+// findScopeEnd returns the line of the `end` closing the scope opened on
+// startLine, or -1 when it is closed on the same line or never closed
+func findScopeEnd(lines []string, startLine int) int {
+	stack := []*rubyScope{{Kind: "top"}}
+
+	var constants []RubyConstant
+
+	for i := startLine; i < len(lines); i++ {
+		stack = scanRubyLine(stack, lines[i], &constants)
+
+		if len(stack) == 1 {
+			if i == startLine {
+				return -1
+			}
+
+			return i
+		}
+	}
+
+	return -1
+}
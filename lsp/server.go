@@ -2,8 +2,12 @@ package lsp
 
 import (
 	"encoding/json"
-	"os"
+	"fmt"
+	"maps"
+	"net/url"
+	"os/exec"
 	"strings"
+	"sync"
 
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
@@ -11,40 +15,86 @@ import (
 )
 
 var handler protocol.Handler
-var documentContents = make(map[string]string)
+
+// documentContents is written on the read loop and read from the
+// goroutines publishing diagnostics, always go through the accessors
+var (
+	documentContents = make(map[string]string)
+	documentsMutex   sync.RWMutex
+)
+
+func getOpenDocument(uri string) (string, bool) {
+	documentsMutex.RLock()
+	defer documentsMutex.RUnlock()
+
+	content, ok := documentContents[uri]
+
+	return content, ok
+}
+
+func setOpenDocument(uri string, content string) {
+	documentsMutex.Lock()
+	documentContents[uri] = content
+	documentsMutex.Unlock()
+}
+
+// getOpenDocuments returns a copy of every open document by uri
+func getOpenDocuments() map[string]string {
+	documentsMutex.RLock()
+	defer documentsMutex.RUnlock()
+
+	return maps.Clone(documentContents)
+}
 
 func NewServer() *server.Server {
 	handler = protocol.Handler{
-		Initialize:             initialize,
-		TextDocumentDidOpen:    textDocumentDidOpen,
-		TextDocumentCompletion: textDocumentCompletion,
-		TextDocumentDidChange:  textDocumentDidChange,
-		TextDocumentDidSave:    textDocumentDidSave,
-		TextDocumentDefinition: textDocumentDefinition,
-		TextDocumentHover:      textDocumentHover,
-		TextDocumentCodeLens:   textDocumentCodeLens,
-		TextDocumentCodeAction: textDocumentCodeAction,
+		Initialize:                         initialize,
+		Initialized:                        initialized,
+		CodeActionResolve:                  codeActionResolve,
+		TextDocumentDidOpen:                textDocumentDidOpen,
+		TextDocumentCompletion:             textDocumentCompletion,
+		CompletionItemResolve:              completionItemResolve,
+		TextDocumentDidChange:              textDocumentDidChange,
+		TextDocumentDidSave:                textDocumentDidSave,
+		TextDocumentDefinition:             textDocumentDefinition,
+		TextDocumentHover:                  textDocumentHover,
+		TextDocumentCodeLens:               textDocumentCodeLens,
+		TextDocumentCodeAction:             textDocumentCodeAction,
+		TextDocumentDocumentLink:           textDocumentDocumentLink,
+		WorkspaceExecuteCommand:            workspaceExecuteCommand,
+		WorkspaceDidChangeWorkspaceFolders: workspaceDidChangeWorkspaceFolders,
+		WorkspaceDidChangeConfiguration:    workspaceDidChangeConfiguration,
 	}
 
 	server := server.NewServer(&handler, "ruby-ti", false)
 	return server
 }
 
-func isConfigExists() bool {
-	if _, err := os.Stat(".ti-config"); os.IsNotExist(err) {
-		return false
-	}
-
-	return true
-}
-
 func initialize(
 	ctx *glsp.Context,
 	params *protocol.InitializeParams,
 ) (any, error) {
 
-	if !isConfigExists() {
-		return protocol.InitializeResult{}, nil
+	clientContext = ctx
+	updateSettings(params.InitializationOptions)
+	setWorkspaceFolders(params)
+	setCodeActionResolveSupport(params)
+	setCreateFileSupport(params)
+
+	if params.Capabilities.Workspace != nil &&
+		params.Capabilities.Workspace.Configuration != nil {
+		supportsConfiguration = *params.Capabilities.Workspace.Configuration
+	}
+
+	if _, err := exec.LookPath(getBaseSettings().TiPath); err != nil {
+		showMessage(
+			ctx,
+			protocol.MessageTypeError,
+			fmt.Sprintf(
+				"ruby-ti: '%s' command not found, install Ruby-TI (https://github.com/engneer-hamachan/ruby-ti) or set tiPath",
+				getBaseSettings().TiPath,
+			),
+		)
 	}
 
 	capabilities := handler.CreateServerCapabilities()
@@ -56,12 +106,17 @@ func initialize(
 			"A", "B", "C", "D", "E", "F", "G", "H", "I", "J", "K", "L", "M",
 			"N", "O", "P", "Q", "R", "S", "T", "U", "V", "W", "X", "Y", "Z",
 			"0", "1", "2", "3", "4", "5", "6", "7", "8", "9",
-			".", "_",
+			".", "_", "@", ":", "/", "\"", "'",
 		},
+		ResolveProvider: &[]bool{true}[0],
 	}
 
 	capabilities.HoverProvider = true
 
+	capabilities.DocumentLinkProvider = &protocol.DocumentLinkOptions{
+		ResolveProvider: &[]bool{false}[0],
+	}
+
 	capabilities.CodeLensProvider = &protocol.CodeLensOptions{
 		ResolveProvider: &[]bool{false}[0],
 	}
@@ -69,9 +124,23 @@ func initialize(
 	capabilities.CodeActionProvider = &protocol.CodeActionOptions{
 		CodeActionKinds: []protocol.CodeActionKind{
 			protocol.CodeActionKindQuickFix,
+			protocol.CodeActionKindRefactorExtract,
+			codeActionKindGenerateConfig,
+		},
+		ResolveProvider: &[]bool{true}[0],
+	}
+
+	capabilities.Workspace = &protocol.ServerCapabilitiesWorkspace{
+		WorkspaceFolders: &protocol.WorkspaceFoldersServerCapabilities{
+			Supported:           &[]bool{true}[0],
+			ChangeNotifications: &protocol.BoolOrString{Value: true},
 		},
 	}
 
+	capabilities.ExecuteCommandProvider = &protocol.ExecuteCommandOptions{
+		Commands: serverCommandNames(),
+	}
+
 	syncKind := protocol.TextDocumentSyncKindFull
 
 	capabilities.TextDocumentSync =
@@ -95,7 +164,7 @@ func textDocumentDidOpen(
 	params *protocol.DidOpenTextDocumentParams,
 ) error {
 
-	documentContents[params.TextDocument.URI] = params.TextDocument.Text
+	setOpenDocument(params.TextDocument.URI, params.TextDocument.Text)
 
 	go publishDiagnostics(ctx, params.TextDocument.URI, params.TextDocument.Text)
 
@@ -123,7 +192,8 @@ func textDocumentDidChange(
 	}
 
 	if err := json.Unmarshal(changeEventBytes, &changeEvent); err == nil {
-		documentContents[params.TextDocument.URI] = changeEvent.Text
+		setOpenDocument(params.TextDocument.URI, changeEvent.Text)
+		invalidateReceiverCache(params.TextDocument.URI)
 
 		go publishDiagnostics(ctx, params.TextDocument.URI, changeEvent.Text)
 	}
@@ -136,11 +206,13 @@ func textDocumentDidSave(
 	params *protocol.DidSaveTextDocumentParams,
 ) error {
 
-	content, ok := documentContents[params.TextDocument.URI]
+	content, ok := getOpenDocument(params.TextDocument.URI)
 	if ok {
 		content = *params.Text
 	}
 
+	invalidateReceiverCache(params.TextDocument.URI)
+
 	go publishDiagnostics(ctx, params.TextDocument.URI, content)
 
 	return nil
@@ -151,41 +223,61 @@ func textDocumentCompletion(
 	params *protocol.CompletionParams,
 ) (any, error) {
 
+	scope := findDocumentScope(params.TextDocument.URI)
+
+	if !getSettings(scope).Features.Completion || isIgnoredTrigger(scope, params.Context) {
+		return nil, nil
+	}
+
 	var items []protocol.CompletionItem
 
-	content, ok := documentContents[params.TextDocument.URI]
+	content, ok := getOpenDocument(params.TextDocument.URI)
 	if !ok {
 		return nil, nil
 	}
 
 	var signatures []Sig
 
-	if isJsonFile(params.TextDocument.URI) {
-		signatures = findJsonTypeCompletion(content, params.Position.Line, params.Position.Character)
-	} else {
-		signatures = findComplection(content, params.Position.Line, params.Position.Character)
+	line := params.Position.Line
+	character := params.Position.Character
+
+	prefix, before := getCompletionPrefix(content, line, character)
+
+	switch {
+	case isConfigJsonFile(scope, params.TextDocument.URI):
+		signatures = findJsonCompletion(scope, content, line, character)
+	case isJsonFile(params.TextDocument.URI):
+		return nil, nil
+	case isRequireString(content, line, character):
+		signatures =
+			findRequireCompletion(scope, params.TextDocument.URI, content, line, character)
+	case before == '.':
+		signatures = findComplection(scope, content, line, character)
+	case before == ':':
+		signatures = findNamespaceCompletion(scope, content, line, character)
+	case prefix != "" && prefix[0] >= 'A' && prefix[0] <= 'Z':
+		signatures = findConstantCompletion(scope, content, line, character)
+	default:
+		signatures = append(
+			findKeywordArgumentCompletion(scope, params.TextDocument.URI, content, line, character),
+			findIdentifierCompletion(scope, content, line, character)...,
+		)
 	}
 
-	for _, sig := range signatures {
+	keys := storeCompletionSigs(params.TextDocument.URI, params.Position, signatures)
+
+	for i, sig := range signatures {
 		item := protocol.CompletionItem{
 			Label: sig.Method,
+			Data:  keys[i],
 		}
 
-		var docParts []string
-
-		allSigs := []string{sig.Detail}
-		if len(sig.Overloads) > 0 {
-			allSigs = append(allSigs, sig.Overloads...)
-		}
-		docParts = append(docParts, "```ruby\n"+strings.Join(allSigs, "\n")+"\n```")
-
-		if sig.Documentation != "" {
-			docParts = append(docParts, sig.Documentation)
+		if sig.Detail != "" {
+			item.Detail = &sig.Detail
 		}
 
-		item.Documentation = protocol.MarkupContent{
-			Kind:  protocol.MarkupKindMarkdown,
-			Value: strings.Join(docParts, "\n\n---\n\n"),
+		if sig.Kind != 0 {
+			item.Kind = &sig.Kind
 		}
 
 		items = append(items, item)
@@ -198,17 +290,36 @@ func isJsonFile(uri protocol.DocumentUri) bool {
 	return strings.HasSuffix(string(uri), ".json")
 }
 
+func uriToPath(uri protocol.DocumentUri) string {
+	parsed, err := url.Parse(string(uri))
+	if err != nil || parsed.Scheme != "file" {
+		return strings.TrimPrefix(string(uri), "file://")
+	}
+
+	return parsed.Path
+}
+
 func textDocumentDefinition(
 	ctx *glsp.Context,
 	params *protocol.DefinitionParams,
 ) (any, error) {
 
-	content, ok := documentContents[params.TextDocument.URI]
+	scope := findDocumentScope(params.TextDocument.URI)
+
+	if !getSettings(scope).Features.Definition {
+		return nil, nil
+	}
+
+	content, ok := getOpenDocument(params.TextDocument.URI)
 	if !ok {
 		return nil, nil
 	}
 
-	location, err := findDefinition(content, params)
+	if isConfigJsonFile(scope, params.TextDocument.URI) {
+		return findJsonDefinition(scope, content, params)
+	}
+
+	location, err := findDefinition(scope, content, params)
 
 	return location, err
 }
@@ -218,12 +329,26 @@ func textDocumentHover(
 	params *protocol.HoverParams,
 ) (*protocol.Hover, error) {
 
-	content, ok := documentContents[params.TextDocument.URI]
+	scope := findDocumentScope(params.TextDocument.URI)
+
+	if !getSettings(scope).Features.Hover {
+		return nil, nil
+	}
+
+	content, ok := getOpenDocument(params.TextDocument.URI)
 	if !ok {
 		return nil, nil
 	}
 
-	hover, err := findHover(content, params)
+	if isConfigJsonFile(scope, params.TextDocument.URI) {
+		return findJsonHover(scope, content, params)
+	}
+
+	if isJsonFile(params.TextDocument.URI) {
+		return nil, nil
+	}
+
+	hover, err := findHover(scope, content, params)
 
 	return hover, err
 }
@@ -234,6 +359,8 @@ func publishDiagnostics(
 	content string,
 ) {
 
+	scope := findDocumentScope(uri)
+
 	ctx.Notify(
 		protocol.ServerTextDocumentPublishDiagnostics,
 		&protocol.PublishDiagnosticsParams{
@@ -242,7 +369,19 @@ func publishDiagnostics(
 		},
 	)
 
-	diagnostics := runDiagnostics(content)
+	var diagnostics []protocol.Diagnostic
+
+	switch {
+	case !getSettings(scope).Features.Diagnostics:
+		diagnostics = []protocol.Diagnostic{}
+	case isConfigJsonFile(scope, uri):
+		diagnostics = validateConfigJson(scope, uri, content)
+	case isJsonFile(uri):
+		diagnostics = []protocol.Diagnostic{}
+	default:
+		diagnostics = addDidYouMeanData(scope, content, runDiagnostics(scope, content))
+		diagnostics = append(diagnostics, findRequireDiagnostics(scope, uri, content)...)
+	}
 
 	ctx.Notify(
 		protocol.ServerTextDocumentPublishDiagnostics,
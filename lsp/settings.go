@@ -0,0 +1,287 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"ruby-ti-lsp/cmd"
+	"sync"
+	"time"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// settingsSection is the workspace/configuration section read by the server
+const settingsSection = "rubyTiLsp"
+
+// FeatureSettings switches individual language features on or off
+type FeatureSettings struct {
+	Diagnostics   bool `json:"diagnostics"`
+	Completion    bool `json:"completion"`
+	Hover         bool `json:"hover"`
+	Definition    bool `json:"definition"`
+	CodeLens      bool `json:"codeLens"`
+	CodeActions   bool `json:"codeActions"`
+	DocumentLinks bool `json:"documentLinks"`
+}
+
+// CompletionSettings controls when completion answers
+type CompletionSettings struct {
+	// complete while typing identifiers, not only after . :: and quotes
+	IdentifierTrigger bool `json:"identifierTrigger"`
+}
+
+// Settings are the options a client sends in initializationOptions or
+// workspace/configuration, all of them can change at runtime
+type Settings struct {
+	TiPath     string             `json:"tiPath"`
+	Strict     bool               `json:"strict"`
+	Timeout    int                `json:"timeout"`
+	ConfigDir  string             `json:"configDir"`
+	ClassPath  string             `json:"classPath"`
+	Features   FeatureSettings    `json:"features"`
+	Completion CompletionSettings `json:"completion"`
+}
+
+// baseSettings are the flags with initializationOptions applied, each
+// workspace folder starts from them
+var (
+	baseSettings  Settings
+	settingsOnce  sync.Once
+	settingsMutex sync.Mutex
+)
+
+// defaultSettings starts from the command line flags
+func defaultSettings() Settings {
+	return Settings{
+		TiPath:    "ti",
+		Strict:    cmd.IsStrictMode,
+		Timeout:   1000,
+		ConfigDir: ".ti-config",
+		ClassPath: cmd.ClassPathTemplate,
+		Features: FeatureSettings{
+			Diagnostics:   true,
+			Completion:    true,
+			Hover:         true,
+			Definition:    true,
+			CodeLens:      true,
+			CodeActions:   true,
+			DocumentLinks: true,
+		},
+		Completion: CompletionSettings{
+			IdentifierTrigger: true,
+		},
+	}
+}
+
+func getBaseSettings() Settings {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+
+	settingsOnce.Do(func() { baseSettings = defaultSettings() })
+
+	return baseSettings
+}
+
+// getSettings returns the settings of the workspace folder of scope
+func getSettings(scope *workspaceScope) Settings {
+	if scope.Folder != nil {
+		settingsMutex.Lock()
+		defer settingsMutex.Unlock()
+
+		return scope.Folder.Settings
+	}
+
+	return getBaseSettings()
+}
+
+// mergeSettings applies the fields present in value over current, keeping
+// the rest. It reports whether value was usable
+func mergeSettings(current Settings, value any) (Settings, bool) {
+	if value == nil {
+		return current, false
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return current, false
+	}
+
+	updated := current
+	if err := json.Unmarshal(data, &updated); err != nil {
+		return current, false
+	}
+
+	if updated.TiPath == "" {
+		updated.TiPath = "ti"
+	}
+
+	if updated.Timeout <= 0 {
+		updated.Timeout = defaultSettings().Timeout
+	}
+
+	if updated.ConfigDir == "" {
+		updated.ConfigDir = defaultSettings().ConfigDir
+	}
+
+	return updated, true
+}
+
+// updateSettings applies value to the base settings and every workspace
+// folder. It reports whether value was usable
+func updateSettings(value any) bool {
+	base, ok := mergeSettings(getBaseSettings(), value)
+	if !ok {
+		return false
+	}
+
+	folders := getWorkspaceFolders()
+
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+
+	baseSettings = base
+
+	for _, folder := range folders {
+		folder.Settings, _ = mergeSettings(folder.Settings, value)
+	}
+
+	return true
+}
+
+// setStrictMode flips strict mode everywhere without touching the other
+// settings
+func setStrictMode(strict bool) {
+	getBaseSettings()
+	folders := getWorkspaceFolders()
+
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+
+	baseSettings.Strict = strict
+
+	for _, folder := range folders {
+		folder.Settings.Strict = strict
+	}
+}
+
+// tiTimeoutContext bounds one ti run by the timeout configured for scope
+func tiTimeoutContext(scope *workspaceScope) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(tiContext(), time.Duration(getSettings(scope).Timeout)*time.Millisecond)
+}
+
+// tiCommand runs the ti executable configured for scope in its root
+func tiCommand(scope *workspaceScope, ctx context.Context, args ...string) *exec.Cmd {
+	tiCmd := exec.CommandContext(ctx, getSettings(scope).TiPath, args...)
+	tiCmd.Dir = scope.Root
+
+	// do not wait on pipes a killed ti left open
+	tiCmd.WaitDelay = 100 * time.Millisecond
+
+	return tiCmd
+}
+
+var supportsConfiguration bool
+
+// pullSettings asks the client for the settings section of every workspace
+// folder. It must not be called from the connection's read loop
+func pullSettings(ctx *glsp.Context) {
+	folders := getWorkspaceFolders()
+
+	items := []protocol.ConfigurationItem{
+		{Section: &[]string{settingsSection}[0]},
+	}
+
+	for _, folder := range folders {
+		items = append(items, protocol.ConfigurationItem{
+			ScopeURI: &folder.URI,
+			Section:  &[]string{settingsSection}[0],
+		})
+	}
+
+	var result []any
+
+	ctx.Call(
+		protocol.ServerWorkspaceConfiguration,
+		protocol.ConfigurationParams{Items: items},
+		&result,
+	)
+
+	if len(result) != len(items) {
+		return
+	}
+
+	base, _ := mergeSettings(getBaseSettings(), result[0])
+
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+
+	baseSettings = base
+
+	// folder settings are resolved again from the base, so settings removed
+	// from a folder fall back to the workspace ones
+	for i, folder := range folders {
+		folder.Settings, _ = mergeSettings(base, result[i+1])
+	}
+}
+
+func initialized(
+	ctx *glsp.Context,
+	params *protocol.InitializedParams,
+) error {
+
+	go func() {
+		if supportsConfiguration {
+			pullSettings(ctx)
+			rerunDiagnostics(ctx, nil)
+		}
+
+		// without a config the server still runs on ti's built-in types
+		if !isConfigExists() {
+			promptCreateConfig(ctx)
+		}
+	}()
+
+	return nil
+}
+
+func workspaceDidChangeConfiguration(
+	ctx *glsp.Context,
+	params *protocol.DidChangeConfigurationParams,
+) error {
+
+	// push style clients send the settings, pull style clients only notify
+	pushed := false
+	if sections, ok := params.Settings.(map[string]any); ok {
+		pushed = updateSettings(sections[settingsSection])
+	}
+
+	go func() {
+		if !pushed && supportsConfiguration {
+			pullSettings(ctx)
+		}
+
+		rerunDiagnostics(ctx, nil)
+	}()
+
+	return nil
+}
+
+// isIgnoredTrigger tells whether completion was triggered by typing an
+// identifier character while identifierTrigger is off
+func isIgnoredTrigger(scope *workspaceScope, context *protocol.CompletionContext) bool {
+	if getSettings(scope).Completion.IdentifierTrigger || context == nil {
+		return false
+	}
+
+	if context.TriggerKind != protocol.CompletionTriggerKindTriggerCharacter ||
+		context.TriggerCharacter == nil {
+		return false
+	}
+
+	c := *context.TriggerCharacter
+
+	return c != "" && (c[0] == '_' || c[0] >= '0' && c[0] <= '9' ||
+		c[0] >= 'a' && c[0] <= 'z' || c[0] >= 'A' && c[0] <= 'Z')
+}
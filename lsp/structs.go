@@ -1,5 +1,7 @@
 package lsp
 
+import protocol "github.com/tliron/glsp/protocol_3_16"
+
 // Sig represents a method signature
 type Sig struct {
 	Method        string
@@ -11,6 +13,7 @@ type Sig struct {
 	IsStatic      bool
 	FileName      string
 	Row           int
+	Kind          protocol.CompletionItemKind
 }
 
 // ClassNode represents a class in the inheritance hierarchy
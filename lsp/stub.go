@@ -0,0 +1,485 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+var (
+	keywordArgumentPattern = regexp.MustCompile(`^([a-z_]\w*):\s+(.+)$`)
+
+	integerPattern = regexp.MustCompile(`^-?\d[\d_]*$`)
+
+	floatPattern = regexp.MustCompile(`^-?\d[\d_]*\.\d+(e-?\d+)?$`)
+
+	conditionPattern = regexp.MustCompile(`^\s*(if|unless|while|until|elsif)\s+!?\s*$`)
+
+	modifierKeywordPattern = regexp.MustCompile(`^(then|if|unless|while|until|and|or|rescue)\b`)
+)
+
+// conversion methods whose name says what they return
+var conventionalReturnTypes = map[string]string{
+	"to_s":    "String",
+	"to_str":  "String",
+	"inspect": "String",
+	"to_i":    "Int",
+	"to_int":  "Int",
+	"to_f":    "Float",
+	"to_a":    "Array",
+	"to_ary":  "Array",
+	"to_h":    "Hash",
+	"to_sym":  "Symbol",
+	"size":    "Int",
+	"length":  "Int",
+	"count":   "Int",
+}
+
+// ti reports some classes under their Ruby names
+var tiTypeNames = map[string]string{
+	"Integer":    "Int",
+	"TrueClass":  "Bool",
+	"FalseClass": "Bool",
+	"Boolean":    "Bool",
+	"Nil":        "NilClass",
+	"Proc":       "Block",
+}
+
+// CallSite is a call of the undefined method on the diagnostic line
+type CallSite struct {
+	Start       int
+	End         int
+	Arguments   []string
+	HasBlock    bool
+	BlockParams []string
+}
+
+// splitTopLevel splits s at sep outside of brackets and string literals
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+
+	stripped := stripRubyLine(s)
+	if len(stripped) < len(s) {
+		s = s[:len(stripped)]
+	}
+
+	depth := 0
+	start := 0
+
+	for i := 0; i < len(stripped); i++ {
+		switch stripped[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		parts = append(parts, last)
+	}
+
+	return parts
+}
+
+// findCallSite locates `recv.name(args) { |params| }` on line
+func findCallSite(line string, methodName string) *CallSite {
+	pattern, err :=
+		regexp.Compile(`(?:^|[.\s(,=]|::)(` + regexp.QuoteMeta(methodName) + `)(?:[^\w?!=]|$)`)
+	if err != nil {
+		return nil
+	}
+
+	stripped := stripRubyLine(line)
+
+	loc := pattern.FindStringSubmatchIndex(stripped)
+	if loc == nil {
+		return nil
+	}
+
+	call := &CallSite{Start: loc[2], End: loc[3]}
+	rest := stripped[call.End:]
+
+	switch {
+	case strings.HasPrefix(rest, "("):
+		depth := 0
+		for i := 0; i < len(rest); i++ {
+			switch rest[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+
+			if depth == 0 {
+				call.Arguments = splitTopLevel(line[call.End+1:call.End+i], ',')
+				call.End += i + 1
+				break
+			}
+		}
+
+	case strings.HasPrefix(rest, " ") && !strings.HasPrefix(strings.TrimSpace(rest), "{") &&
+		!strings.HasPrefix(strings.TrimSpace(rest), "do"):
+
+		// command call without parentheses: foo 1, 2
+		args := rest
+		if idx := strings.Index(args, " do"); idx != -1 {
+			args = args[:idx]
+		}
+
+		trimmed := strings.TrimSpace(args)
+		if trimmed != "" && strings.IndexByte("=+-*/<>&|?:.%", trimmed[0]) == -1 &&
+			!modifierKeywordPattern.MatchString(trimmed) {
+
+			call.Arguments = splitTopLevel(line[call.End:call.End+len(args)], ',')
+			call.End += len(args)
+		}
+	}
+
+	after := strings.TrimSpace(stripped[call.End:])
+	if strings.HasPrefix(after, "{") || strings.HasPrefix(after, "do") {
+		call.HasBlock = true
+
+		if matches := blockParamPattern.FindStringSubmatch(after); matches != nil {
+			call.BlockParams = parseParamNames(matches[1])
+		}
+	}
+
+	return call
+}
+
+func inferLiteralType(expr string) string {
+	switch {
+	case expr == "true" || expr == "false":
+		return "Bool"
+	case expr == "nil":
+		return "NilClass"
+	case integerPattern.MatchString(expr):
+		return "Int"
+	case floatPattern.MatchString(expr):
+		return "Float"
+	case strings.HasPrefix(expr, `"`) || strings.HasPrefix(expr, "'"):
+		return "String"
+	case strings.HasPrefix(expr, ":") && !strings.HasPrefix(expr, "::"):
+		return "Symbol"
+	case strings.HasPrefix(expr, "["):
+		return "Array"
+	case strings.HasPrefix(expr, "{"):
+		return "Hash"
+	case strings.Contains(expr, ".."):
+		return "Range"
+	case strings.HasPrefix(expr, "->") || strings.HasPrefix(expr, "lambda") || strings.HasPrefix(expr, "proc"):
+		return "Block"
+	}
+
+	return ""
+}
+
+// inferExpressionType asks ti for the class of expr evaluated on line
+func inferExpressionType(scope *workspaceScope, content string, line uint32, expr string) string {
+	if typeName := inferLiteralType(expr); typeName != "" {
+		return typeName
+	}
+
+	_, className := getReceiverClass(scope, content, line, "("+expr+").itself")
+	if className == "" {
+		return "Untyped"
+	}
+
+	if typeName, ok := tiTypeNames[className]; ok {
+		return typeName
+	}
+
+	return className
+}
+
+// inferExpectedReturnType guesses what the caller expects back
+func inferExpectedReturnType(
+	scope *workspaceScope,
+	content string,
+	line uint32,
+	call *CallSite,
+	methodName string,
+	argumentTypes []string,
+) string {
+
+	if typeName, ok := conventionalReturnTypes[methodName]; ok {
+		return typeName
+	}
+
+	switch {
+	case strings.HasSuffix(methodName, "?"):
+		return "Bool"
+	case strings.HasSuffix(methodName, "=") && len(argumentTypes) > 0:
+		return argumentTypes[0]
+	case strings.HasSuffix(methodName, "!"):
+		return "Self"
+	}
+
+	lines := strings.Split(content, "\n")
+	currentLine := lines[line]
+
+	before := currentLine[:call.Start]
+	if idx := strings.LastIndexAny(before, " \t(,=!"); idx != -1 {
+		before = before[:idx+1]
+	}
+
+	if conditionPattern.MatchString(before) {
+		return "Bool"
+	}
+
+	// passed straight into another call: bar(foo.undefined)
+	enclosing := findCallAtCursor(content, line, uint32(call.Start))
+	if enclosing == nil {
+		return "Untyped"
+	}
+
+	_, className := getReceiverClass(scope, content, enclosing.Line, enclosing.Target)
+	if className == "" {
+		return "Untyped"
+	}
+
+	method := findConfigMethod(
+		loadClassConfigs(scope),
+		className,
+		extractMethodName(enclosing.Target, len(enclosing.Target)),
+		false,
+		make(map[string]bool),
+	)
+
+	if method == nil {
+		return "Untyped"
+	}
+
+	// arguments already written before this one, the last part is ours
+	position := len(splitTopLevel(currentLine[strings.LastIndex(before, "(")+1:call.Start]+"_", ',')) - 1
+	if position < len(method.Arguments) && len(method.Arguments[position].Type) > 0 {
+		return method.Arguments[position].Type[0]
+	}
+
+	return "Untyped"
+}
+
+// inferMethodStub builds a typed TiMethod from how the undefined method
+// is called on the diagnostic line
+func inferMethodStub(scope *workspaceScope, uri protocol.DocumentUri, errorInfo *ErrorInfo) TiMethod {
+	stub := TiMethod{
+		Name:      errorInfo.MethodName,
+		Arguments: []TiArgument{},
+		ReturnType: TiReturnType{
+			Type: []string{"Untyped"},
+		},
+	}
+
+	content := getDocumentContent(uri)
+
+	lines := strings.Split(content, "\n")
+	if int(errorInfo.Line) >= len(lines) {
+		return stub
+	}
+
+	call := findCallSite(lines[errorInfo.Line], errorInfo.MethodName)
+	if call == nil {
+		return stub
+	}
+
+	var argumentTypes []string
+
+	for _, argument := range call.Arguments {
+		switch {
+		case strings.HasPrefix(argument, "&"):
+			call.HasBlock = true
+
+		case strings.HasPrefix(argument, "**"):
+			stub.Arguments = append(stub.Arguments, TiArgument{Type: []string{"Hash"}})
+
+		case strings.HasPrefix(argument, "*"):
+			stub.Arguments = append(stub.Arguments, TiArgument{
+				Type:       []string{"Untyped"},
+				IsAsterisk: true,
+			})
+
+		default:
+			if matches := keywordArgumentPattern.FindStringSubmatch(argument); matches != nil {
+				stub.Arguments = append(stub.Arguments, TiArgument{
+					Type: []string{inferExpressionType(scope, content, errorInfo.Line, matches[2])},
+					Key:  matches[1],
+				})
+
+				continue
+			}
+
+			typeName := inferExpressionType(scope, content, errorInfo.Line, argument)
+			argumentTypes = append(argumentTypes, typeName)
+
+			stub.Arguments = append(stub.Arguments, TiArgument{Type: []string{typeName}})
+		}
+	}
+
+	if call.HasBlock {
+		stub.BlockParameters = []string{}
+		for range call.BlockParams {
+			stub.BlockParameters = append(stub.BlockParameters, "Untyped")
+		}
+	}
+
+	stub.ReturnType.Type = []string{
+		inferExpectedReturnType(scope, content, errorInfo.Line, call, errorInfo.MethodName, argumentTypes),
+	}
+
+	return stub
+}
+
+// supportsCodeActionResolve is set when the client can resolve the edit of
+// a code action lazily
+var supportsCodeActionResolve bool
+
+func setCodeActionResolveSupport(params *protocol.InitializeParams) {
+	textDocument := params.Capabilities.TextDocument
+	if textDocument == nil || textDocument.CodeAction == nil ||
+		textDocument.CodeAction.ResolveSupport == nil {
+		return
+	}
+
+	supportsCodeActionResolve =
+		slices.Contains(textDocument.CodeAction.ResolveSupport.Properties, "edit")
+}
+
+// MethodStubData identifies an add method quick fix whose typed stub is
+// inferred only once the fix is picked
+type MethodStubData struct {
+	URI         protocol.DocumentUri `json:"uri"`
+	Line        uint32               `json:"line"`
+	Message     string               `json:"message"`
+	TargetClass string               `json:"targetClass"`
+}
+
+// deferMethodStub drops the edit of an add method action. The typed stub
+// takes a ti run per argument, too many to start on every cursor move, so
+// it is built in codeAction/resolve or, for clients that cannot resolve,
+// by the ruby-ti.addConfigMethod command
+func deferMethodStub(
+	action *protocol.CodeAction,
+	uri protocol.DocumentUri,
+	errorInfo *ErrorInfo,
+	targetClass string,
+) {
+
+	data := MethodStubData{
+		URI:         uri,
+		Line:        errorInfo.Line,
+		Message:     errorInfo.ErrorMessage,
+		TargetClass: targetClass,
+	}
+
+	action.Edit = nil
+
+	if supportsCodeActionResolve {
+		action.Data = data
+		return
+	}
+
+	action.Command = &protocol.Command{
+		Title:     action.Title,
+		Command:   "ruby-ti.addConfigMethod",
+		Arguments: []any{data},
+	}
+}
+
+// makeMethodStubEdit infers the stub described by data and returns the edit
+// adding it to the target class
+func makeMethodStubEdit(data MethodStubData) (*protocol.WorkspaceEdit, error) {
+	errorInfo := parseErrorMessage(data.Message, data.Line)
+	if errorInfo == nil || errorInfo.ErrorType != "method" {
+		return nil, fmt.Errorf("not an undefined method: %s", data.Message)
+	}
+
+	scope := findDocumentScope(data.URI)
+
+	action := createMethodCodeActionForClass(
+		scope,
+		errorInfo,
+		protocol.Diagnostic{},
+		data.TargetClass,
+		inferMethodStub(scope, data.URI, errorInfo),
+	)
+
+	if action == nil {
+		return nil, fmt.Errorf("cannot add '%s' to '%s'", errorInfo.MethodName, data.TargetClass)
+	}
+
+	return action.Edit, nil
+}
+
+func decodeMethodStubData(value any) (MethodStubData, error) {
+	var data MethodStubData
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return data, err
+	}
+
+	err = json.Unmarshal(raw, &data)
+
+	return data, err
+}
+
+func codeActionResolve(
+	ctx *glsp.Context,
+	params *protocol.CodeAction,
+) (*protocol.CodeAction, error) {
+
+	if params.Data == nil {
+		return params, nil
+	}
+
+	data, err := decodeMethodStubData(params.Data)
+	if err != nil {
+		return params, nil
+	}
+
+	edit, err := makeMethodStubEdit(data)
+	if err != nil {
+		return params, nil
+	}
+
+	params.Edit = edit
+
+	return params, nil
+}
+
+// addConfigMethod applies an add method quick fix for clients without
+// codeAction/resolve
+func addConfigMethod(ctx *glsp.Context, arguments []any) (any, error) {
+	if len(arguments) < 1 {
+		return nil, fmt.Errorf("ruby-ti.addConfigMethod expects the quick fix data")
+	}
+
+	data, err := decodeMethodStubData(arguments[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// inferring the stub runs ti, keep it off the read loop
+	go func() {
+		edit, err := makeMethodStubEdit(data)
+		if err != nil {
+			showMessage(ctx, protocol.MessageTypeError, err.Error())
+			return
+		}
+
+		applyWorkspaceEdit(ctx, fmt.Sprintf("Add method to '%s'", data.TargetClass), *edit)
+	}()
+
+	return nil, nil
+}
@@ -0,0 +1,51 @@
+package lsp
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestInferMethodStubBlockParameters(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"foo.bar", ""},
+		{"foo.bar { baz }", `"block_parameters":[]`},
+		{"foo.bar { |a, b| baz }", `"block_parameters":["Untyped","Untyped"]`},
+	}
+
+	scope := &workspaceScope{Root: t.TempDir()}
+
+	for _, test := range tests {
+		uri := protocol.DocumentUri("file://" + scope.Root + "/test.rb")
+		setOpenDocument(string(uri), test.content)
+
+		stub := inferMethodStub(scope, uri, &ErrorInfo{MethodName: "bar"})
+
+		data, err := json.Marshal(stub)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if test.want == "" {
+			if strings.Contains(string(data), "block_parameters") {
+				t.Errorf("inferMethodStub(%q) = %s, want no block_parameters", test.content, data)
+			}
+		} else if !strings.Contains(string(data), test.want) {
+			t.Errorf("inferMethodStub(%q) = %s, want %s", test.content, data, test.want)
+		}
+
+		var decoded TiMethod
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		if (decoded.BlockParameters == nil) != (stub.BlockParameters == nil) {
+			t.Errorf("inferMethodStub(%q) block parameters %v decoded as %v", test.content, stub.BlockParameters, decoded.BlockParameters)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// serverStatusNotification tells the client whether ti is working, so it
+// can tell broken analysis apart from clean code
+const serverStatusNotification = "ruby-ti/status"
+
+const showLogAction = "Show log"
+
+// TiFailure is one ti run that did not produce a usable result
+type TiFailure struct {
+	Args     []string
+	Dir      string
+	ExitCode int
+	Stderr   string
+	Duration time.Duration
+	Err      error
+}
+
+func (f TiFailure) String() string {
+	var builder strings.Builder
+
+	fmt.Fprintf(
+		&builder,
+		"ti %s (in %s) failed after %s, exit code %d: %v",
+		strings.Join(f.Args, " "),
+		f.Dir,
+		f.Duration.Round(time.Millisecond),
+		f.ExitCode,
+		f.Err,
+	)
+
+	if stderr := strings.TrimSpace(f.Stderr); stderr != "" {
+		builder.WriteString("\n" + stderr)
+	}
+
+	return builder.String()
+}
+
+// ServerStatus is the payload of ruby-ti/status
+type ServerStatus struct {
+	State   string `json:"state"`
+	Message string `json:"message"`
+}
+
+var (
+	clientContext  *glsp.Context
+	tiStatusMutex  sync.Mutex
+	tiFailing      bool
+	tiFailureShown bool
+)
+
+// tiFailureLogPath is where failures are kept for the "Show log" action
+func tiFailureLogPath() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("ruby-ti-lsp-%d.log", os.Getpid()))
+}
+
+// lockedWriter lets the stdout and stderr copies of a command share one
+// buffer, as CombinedOutput does
+type lockedWriter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.writer.Write(p)
+}
+
+// runTi runs tiCmd like Output and reports the run when ti could not be
+// started, timed out or crashed. A non-zero exit with nothing on stderr is
+// how ti reports type errors and counts as a success
+func runTi(ctx context.Context, tiCmd *exec.Cmd) ([]byte, error) {
+	return runTiOutput(ctx, tiCmd, false)
+}
+
+// runTiCombined is runTi returning stdout and stderr interleaved like
+// CombinedOutput, for callers that parse what ti prints on either
+func runTiCombined(ctx context.Context, tiCmd *exec.Cmd) ([]byte, error) {
+	return runTiOutput(ctx, tiCmd, true)
+}
+
+func runTiOutput(ctx context.Context, tiCmd *exec.Cmd, combined bool) ([]byte, error) {
+	var stderr bytes.Buffer
+	tiCmd.Stderr = &stderr
+
+	var output []byte
+	var err error
+
+	start := time.Now()
+
+	if combined {
+		var buffer bytes.Buffer
+
+		shared := &lockedWriter{writer: &buffer}
+		tiCmd.Stdout = shared
+		tiCmd.Stderr = io.MultiWriter(shared, &stderr)
+
+		err = tiCmd.Run()
+		output = buffer.Bytes()
+	} else {
+		output, err = tiCmd.Output()
+	}
+
+	failure := TiFailure{
+		Args:     tiCmd.Args[1:],
+		Dir:      tiCmd.Dir,
+		ExitCode: -1,
+		Stderr:   stderr.String(),
+		Duration: time.Since(start),
+		Err:      err,
+	}
+
+	if tiCmd.ProcessState != nil {
+		failure.ExitCode = tiCmd.ProcessState.ExitCode()
+	}
+
+	var exitErr *exec.ExitError
+
+	switch {
+	case err == nil:
+		reportTiSuccess()
+	case errors.Is(ctx.Err(), context.Canceled):
+		// restartTi killed it on purpose
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		failure.Err = fmt.Errorf("timed out after %s", failure.Duration.Round(time.Millisecond))
+		reportTiFailure(failure)
+	case errors.As(err, &exitErr) && strings.TrimSpace(failure.Stderr) == "":
+		reportTiSuccess()
+	default:
+		reportTiFailure(failure)
+	}
+
+	return output, err
+}
+
+func sendServerStatus(state string, message string) {
+	if clientContext == nil {
+		return
+	}
+
+	clientContext.Notify(serverStatusNotification, ServerStatus{State: state, Message: message})
+}
+
+func reportTiSuccess() {
+	tiStatusMutex.Lock()
+	recovered := tiFailing
+	tiFailing = false
+	tiStatusMutex.Unlock()
+
+	if recovered {
+		sendServerStatus("ok", "ti is running")
+	}
+}
+
+// reportTiFailure logs every failure, but interrupts the user only for the
+// first one until ti is restarted
+func reportTiFailure(failure TiFailure) {
+	message := failure.String()
+
+	if file, err := os.OpenFile(tiFailureLogPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err == nil {
+		fmt.Fprintf(file, "%s %s\n", time.Now().Format(time.RFC3339), message)
+		file.Close()
+	}
+
+	tiStatusMutex.Lock()
+	tiFailing = true
+	shouldShow := !tiFailureShown
+	tiFailureShown = true
+	tiStatusMutex.Unlock()
+
+	if clientContext == nil {
+		return
+	}
+
+	clientContext.Notify(protocol.ServerWindowLogMessage, protocol.LogMessageParams{
+		Type:    protocol.MessageTypeError,
+		Message: message,
+	})
+
+	sendServerStatus("error", message)
+
+	if shouldShow {
+		go promptTiFailure(clientContext, failure)
+	}
+}
+
+// promptTiFailure shows a failure and opens the log on request. It must
+// not be called from the connection's read loop
+func promptTiFailure(ctx *glsp.Context, failure TiFailure) {
+	var action *protocol.MessageActionItem
+
+	ctx.Call(
+		protocol.ServerWindowShowMessageRequest,
+		protocol.ShowMessageRequestParams{
+			Type: protocol.MessageTypeError,
+			Message: fmt.Sprintf(
+				"ruby-ti: ti failed (%v), results may be missing until it works again",
+				failure.Err,
+			),
+			Actions: []protocol.MessageActionItem{{Title: showLogAction}},
+		},
+		&action,
+	)
+
+	if action == nil || action.Title != showLogAction {
+		return
+	}
+
+	var result protocol.ShowDocumentResult
+
+	ctx.Call(
+		protocol.ServerWindowShowDocument,
+		protocol.ShowDocumentParams{
+			URI:       protocol.URI("file://" + tiFailureLogPath()),
+			TakeFocus: &[]bool{true}[0],
+		},
+		&result,
+	)
+}
+
+// resetTiStatus lets the next failure be shown again
+func resetTiStatus() {
+	tiStatusMutex.Lock()
+	tiFailing = false
+	tiFailureShown = false
+	tiStatusMutex.Unlock()
+
+	sendServerStatus("ok", "ti is running")
+}
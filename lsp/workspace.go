@@ -0,0 +1,234 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// WorkspaceFolder is one root the client opened, with its own settings
+type WorkspaceFolder struct {
+	URI      protocol.DocumentUri
+	Root     string
+	Settings Settings
+}
+
+// workspaceScope is the project a request works on: the nearest directory
+// holding .ti-config and the workspace folder it belongs to. Requests look
+// it up from their document and pass it down to everything reading
+// settings or running ti
+type workspaceScope struct {
+	Root   string
+	Folder *WorkspaceFolder
+}
+
+var (
+	workspaceFolders []*WorkspaceFolder
+	foldersMutex     sync.Mutex
+)
+
+func newWorkspaceFolder(uri protocol.DocumentUri) *WorkspaceFolder {
+	return &WorkspaceFolder{
+		URI:      uri,
+		Root:     uriToPath(uri),
+		Settings: getBaseSettings(),
+	}
+}
+
+// setWorkspaceFolders takes every workspace folder, falling back to rootUri
+// and the deprecated rootPath
+func setWorkspaceFolders(params *protocol.InitializeParams) {
+	var folders []*WorkspaceFolder
+
+	switch {
+	case len(params.WorkspaceFolders) > 0:
+		for _, folder := range params.WorkspaceFolders {
+			folders = append(folders, newWorkspaceFolder(folder.URI))
+		}
+	case params.RootURI != nil:
+		folders = append(folders, newWorkspaceFolder(*params.RootURI))
+	case params.RootPath != nil:
+		folders = append(folders, newWorkspaceFolder(protocol.DocumentUri("file://"+*params.RootPath)))
+	}
+
+	foldersMutex.Lock()
+	workspaceFolders = folders
+	foldersMutex.Unlock()
+}
+
+func getWorkspaceFolders() []*WorkspaceFolder {
+	foldersMutex.Lock()
+	defer foldersMutex.Unlock()
+
+	return slices.Clone(workspaceFolders)
+}
+
+// isPathInside tells whether path is dir or below it
+func isPathInside(path string, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// findWorkspaceFolder returns the innermost folder holding path
+func findWorkspaceFolder(path string) *WorkspaceFolder {
+	var found *WorkspaceFolder
+
+	for _, folder := range getWorkspaceFolders() {
+		if !isPathInside(path, folder.Root) {
+			continue
+		}
+
+		if found == nil || len(folder.Root) > len(found.Root) {
+			found = folder
+		}
+	}
+
+	return found
+}
+
+// findScope resolves the project of dir: the nearest ancestor holding the
+// config directory, not leaving the workspace folder
+func findScope(dir string) *workspaceScope {
+	folder := findWorkspaceFolder(dir)
+
+	configDir := getBaseSettings().ConfigDir
+	if folder != nil {
+		settingsMutex.Lock()
+		configDir = folder.Settings.ConfigDir
+		settingsMutex.Unlock()
+	}
+
+	if !filepath.IsAbs(configDir) {
+		for current := dir; ; current = filepath.Dir(current) {
+			if stat, err := os.Stat(filepath.Join(current, configDir)); err == nil && stat.IsDir() {
+				return &workspaceScope{Root: current, Folder: folder}
+			}
+
+			if (folder != nil && current == folder.Root) || current == filepath.Dir(current) {
+				break
+			}
+		}
+	}
+
+	if folder != nil {
+		return &workspaceScope{Root: folder.Root, Folder: folder}
+	}
+
+	return &workspaceScope{Root: getDefaultRoot()}
+}
+
+// findDocumentScope resolves the project of the document at uri
+func findDocumentScope(uri protocol.DocumentUri) *workspaceScope {
+	return findScope(filepath.Dir(uriToPath(uri)))
+}
+
+// findDefaultScope resolves the project of the first workspace folder, for
+// commands that are not about a document
+func findDefaultScope() *workspaceScope {
+	return findScope(getDefaultRoot())
+}
+
+// getDefaultRoot is the first workspace folder, or the process directory
+// when the client sent none
+func getDefaultRoot() string {
+	if folders := getWorkspaceFolders(); len(folders) > 0 {
+		return folders[0].Root
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "."
+	}
+
+	return cwd
+}
+
+// isConfigExists tells whether a workspace folder, or the process directory
+// when there is none, holds its config directory at the root or in a
+// project below it, like the apps of a monorepo
+func isConfigExists() bool {
+	scopes := []*workspaceScope{{Root: getDefaultRoot()}}
+
+	if folders := getWorkspaceFolders(); len(folders) > 0 {
+		scopes = nil
+
+		for _, folder := range folders {
+			scopes = append(scopes, &workspaceScope{Root: folder.Root, Folder: folder})
+		}
+	}
+
+	for _, scope := range scopes {
+		if findBuiltinConfigDir(scope) != "" {
+			return true
+		}
+
+		configDir := getSettings(scope).ConfigDir
+		if !filepath.IsAbs(configDir) && hasNestedConfigDir(scope.Root, configDir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasNestedConfigDir looks for configDir in the directories below root,
+// skipping the ones findWorkspaceRubyFiles skips
+func hasNestedConfigDir(root string, configDir string) bool {
+	found := false
+
+	filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() || path == root {
+			return nil
+		}
+
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || slices.Contains(skipDirs, name) {
+			return filepath.SkipDir
+		}
+
+		if stat, err := os.Stat(filepath.Join(path, configDir)); err == nil && stat.IsDir() {
+			found = true
+			return filepath.SkipAll
+		}
+
+		return nil
+	})
+
+	return found
+}
+
+func workspaceDidChangeWorkspaceFolders(
+	ctx *glsp.Context,
+	params *protocol.DidChangeWorkspaceFoldersParams,
+) error {
+
+	var added []*WorkspaceFolder
+
+	foldersMutex.Lock()
+	for _, removed := range params.Event.Removed {
+		workspaceFolders = slices.DeleteFunc(workspaceFolders, func(folder *WorkspaceFolder) bool {
+			return folder.URI == removed.URI
+		})
+	}
+
+	for _, folder := range params.Event.Added {
+		added = append(added, newWorkspaceFolder(folder.URI))
+	}
+
+	workspaceFolders = append(workspaceFolders, added...)
+	foldersMutex.Unlock()
+
+	go func() {
+		if supportsConfiguration {
+			pullSettings(ctx)
+		}
+
+		rerunDiagnostics(ctx, nil)
+	}()
+
+	return nil
+}
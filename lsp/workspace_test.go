@@ -0,0 +1,37 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsConfigExists(t *testing.T) {
+	tests := []struct {
+		name   string
+		dirs   []string
+		exists bool
+	}{
+		{"none", []string{"app"}, false},
+		{"root", []string{".ti-config"}, true},
+		{"monorepo app", []string{"apps/web/.ti-config"}, true},
+		{"skipped directory", []string{"node_modules/gem/.ti-config", ".git/.ti-config"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			t.Chdir(root)
+
+			for _, dir := range test.dirs {
+				if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if exists := isConfigExists(); exists != test.exists {
+				t.Errorf("isConfigExists() = %v, want %v", exists, test.exists)
+			}
+		})
+	}
+}
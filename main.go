@@ -2,19 +2,19 @@ package main
 
 import (
 	_ "embed"
-	"fmt"
 	"os"
-	"os/exec"
 	"ruby-ti-lsp/cmd"
 	"ruby-ti-lsp/lsp"
 )
 
 func main() {
-	if _, err := exec.LookPath("ti"); err != nil {
-		fmt.Println("Error: 'ti' command not found in PATH")
-		fmt.Println("Ruby-TI LSP requires the 'ti' command to be installed")
-		fmt.Println("Please install Ruby-TI: https://github.com/engneer-hamachan/ruby-ti")
-		os.Exit(1)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import-rbs":
+			os.Exit(lsp.ImportRbs(os.Args[2:]))
+		case "export-rbs":
+			os.Exit(lsp.ExportRbs(os.Args[2:]))
+		}
 	}
 
 	cmd.ParseFlags()
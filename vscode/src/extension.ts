@@ -1,4 +1,4 @@
-import { workspace, window } from 'vscode';
+import { workspace, window, StatusBarAlignment, ThemeColor } from 'vscode';
 import {
   LanguageClient,
   LanguageClientOptions,
@@ -26,7 +26,9 @@ export function activate() {
       { scheme: 'file', language: 'ruby' },
       { scheme: 'file', language: 'json' }
     ],
+    initializationOptions: config,
     synchronize: {
+      configurationSection: 'rubyTiLsp',
       fileEvents: workspace.createFileSystemWatcher('**/*.{rb,json}')
     }
   };
@@ -38,8 +40,26 @@ export function activate() {
     clientOptions
   );
 
+  const status = window.createStatusBarItem(StatusBarAlignment.Left);
+  status.text = '$(check) ti';
+  status.tooltip = 'Ruby-TI: ti is running';
+  status.command = 'ruby-ti.restartTi';
+  status.show();
+
   client.start().then(() => {
     window.showInformationMessage('Ruby-TI LSP: Server started successfully');
+
+    // the server reports when ti fails, so broken analysis is not mistaken
+    // for clean code
+    client.onNotification('ruby-ti/status', (params: { state: string; message: string }) => {
+      const failing = params.state === 'error';
+
+      status.text = failing ? '$(error) ti' : '$(check) ti';
+      status.tooltip = `Ruby-TI: ${params.message}`;
+      status.backgroundColor = failing
+        ? new ThemeColor('statusBarItem.errorBackground')
+        : undefined;
+    });
   }).catch((error) => {
     window.showErrorMessage(`Ruby-TI LSP: Failed to start server: ${error.message}`);
     console.error('Ruby-TI LSP error:', error);